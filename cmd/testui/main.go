@@ -3,12 +3,14 @@ package main
 
 import (
 	"context"
+	"iter"
 	"math/rand"
 	"sort"
 	"time"
 
 	"github.com/gotd/td/tdp"
 	"github.com/gotd/td/telegram/query/messages"
+	"github.com/gotd/td/tg"
 	"github.com/rusq/dlog"
 
 	mtp "github.com/rusq/mtpwrap"
@@ -98,14 +100,24 @@ type FakeTelegram struct {
 func (ft FakeTelegram) GetChats(ctx context.Context) ([]mtp.Entity, error) {
 	return ft.chats, nil
 }
-func (FakeTelegram) SearchAllMyMessages(ctx context.Context, dlg mtp.Entity, cb func(n int)) ([]messages.Elem, error) {
-	var n = rand.Int() % maxFakeMessages
-	var ret = make([]messages.Elem, n)
-	for i := 0; i < len(ret); i++ {
-		cb(1)
-		time.Sleep(fakeSearchDelay)
+func (FakeTelegram) IterMyMessages(ctx context.Context, dlg mtp.Entity, offsetID int, before time.Time) iter.Seq2[messages.Elem, error] {
+	return func(yield func(messages.Elem, error) bool) {
+		var n = rand.Int() % maxFakeMessages
+		if offsetID > 0 {
+			n = min(n, offsetID-1)
+		}
+		now := time.Now()
+		for id := n; id > 0; id-- {
+			time.Sleep(fakeSearchDelay)
+			msg := &tg.Message{ID: id, Date: int(now.Add(-time.Duration(n-id) * time.Hour).Unix())}
+			if !before.IsZero() && msg.Date >= int(before.Unix()) {
+				continue
+			}
+			if !yield(messages.Elem{Msg: msg}, nil) {
+				return
+			}
+		}
 	}
-	return ret, nil
 }
 func (FakeTelegram) DeleteMessages(ctx context.Context, dlg mtp.Entity, messages []messages.Elem) (int, error) {
 	time.Sleep(time.Duration(len(messages)) * fakeDeleteMultiplier)
@@ -0,0 +1,32 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+
+	tds "github.com/gotd/td/session"
+	mtp "github.com/rusq/mtpwrap"
+
+	"github.com/rusq/wipemychat/internal/waipu"
+)
+
+// identity returns the identity of the authenticated user and the current
+// session.  The session is identified by the fingerprint of the authorization
+// key ID, so that the key itself never leaves the session storage.
+func identity(ctx context.Context, cl *mtp.Client, storage tds.Storage) (waipu.Identity, error) {
+	self, err := cl.Client().Self(ctx)
+	if err != nil {
+		return waipu.Identity{}, fmt.Errorf("failed to get the current user: %w", err)
+	}
+	data, err := (&tds.Loader{Storage: storage}).Load(ctx)
+	if err != nil {
+		return waipu.Identity{}, fmt.Errorf("failed to load session: %w", err)
+	}
+	sum := sha256.Sum256(data.AuthKeyID)
+	return waipu.Identity{
+		UserID:  self.ID,
+		Session: hex.EncodeToString(sum[:8]),
+	}, nil
+}
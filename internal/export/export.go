@@ -0,0 +1,269 @@
+package export
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+
+	"github.com/gotd/td/telegram/query/messages"
+	mtp "github.com/rusq/mtpwrap"
+)
+
+const (
+	// resultFile is the name of the JSON file in the chat directory.
+	resultFile = "result.json"
+	// partFile is the name of the partial export in the chat directory,
+	// one JSON message per line, see Exporter.Append.
+	partFile = "result.part.jsonl"
+)
+
+// Format is the export format.
+type Format int
+
+const (
+	// FormatJSON saves the messages as JSON.
+	FormatJSON Format = iota
+	// FormatHTML saves the messages as JSON and renders them as a static
+	// HTML archive, one page per chat.
+	FormatHTML
+)
+
+// ParseFormat parses the format name.
+func ParseFormat(s string) (Format, error) {
+	switch s {
+	case "", "json":
+		return FormatJSON, nil
+	case "html":
+		return FormatHTML, nil
+	}
+	return 0, fmt.Errorf("unknown export format: %q, must be json or html", s)
+}
+
+// Exporter saves the messages to the directory, one subdirectory per chat.
+type Exporter struct {
+	dir    string
+	format Format
+	// dl, if set, is used to download the media files.
+	dl Downloader
+
+	mu      sync.Mutex
+	writers map[int64]*chatWriter
+}
+
+// Option is the Exporter option.
+type Option func(*Exporter)
+
+// WithMedia enables the media download with the downloader dl.
+func WithMedia(dl Downloader) Option {
+	return func(e *Exporter) {
+		e.dl = dl
+	}
+}
+
+// WithFormat sets the export format.
+func WithFormat(f Format) Option {
+	return func(e *Exporter) {
+		e.format = f
+	}
+}
+
+// New creates a new Exporter, that saves messages to the directory dir.
+func New(dir string, opts ...Option) *Exporter {
+	e := &Exporter{dir: dir}
+	for _, opt := range opts {
+		opt(e)
+	}
+	return e
+}
+
+// Export saves the messages msgs of the chat.  If the chat was exported
+// before, the messages are merged with the ones that are already there.  If
+// the media download is enabled, the media files are downloaded first.
+func (e *Exporter) Export(ctx context.Context, chat mtp.Entity, msgs []messages.Elem) error {
+	chatDir := e.chatDir(chat.GetID())
+	if err := os.MkdirAll(chatDir, 0o700); err != nil {
+		return err
+	}
+	c := NewChat(chat, msgs)
+	if e.dl != nil {
+		man, err := LoadManifest(chatDir)
+		if err != nil {
+			return err
+		}
+		if err := e.downloadMedia(ctx, chatDir, man, msgs); err != nil {
+			return err
+		}
+		c.setMedia(man)
+	}
+	return e.save(chatDir, c)
+}
+
+// Append adds the messages msgs to the export of the chat, that is being
+// wiped in batches.  The messages are appended to the partial file in the
+// chat directory, and are saved in the export format by Finish, so that
+// each batch costs the same, regardless of the number of messages already
+// exported.  If the previous run was interrupted before Finish, the
+// messages are appended to the ones it left.
+func (e *Exporter) Append(ctx context.Context, chat mtp.Entity, msgs []messages.Elem) error {
+	cw, err := e.writer(chat)
+	if err != nil {
+		return err
+	}
+	c := NewChat(chat, msgs)
+	if cw.man != nil {
+		if err := e.downloadMedia(ctx, cw.dir, cw.man, msgs); err != nil {
+			return err
+		}
+		c.setMedia(cw.man)
+	}
+	for _, m := range c.Messages {
+		if err := cw.enc.Encode(m); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Finish saves the messages appended by Append in the export format, merging
+// them with the ones exported before, and renders the HTML pages once.  It
+// does nothing, if no messages of the chat were appended.
+func (e *Exporter) Finish(chat mtp.Entity) error {
+	e.mu.Lock()
+	cw, ok := e.writers[chat.GetID()]
+	delete(e.writers, chat.GetID())
+	e.mu.Unlock()
+	if !ok {
+		return nil
+	}
+	if err := cw.f.Close(); err != nil {
+		return err
+	}
+	c := NewChat(chat, nil)
+	f, err := os.Open(cw.f.Name())
+	if err != nil {
+		return err
+	}
+	dec := json.NewDecoder(f)
+	for {
+		var m Message
+		if err := dec.Decode(&m); err != nil {
+			if errors.Is(err, io.EOF) {
+				break
+			}
+			f.Close()
+			return fmt.Errorf("invalid partial export %s: %w", f.Name(), err)
+		}
+		c.Messages = append(c.Messages, m)
+	}
+	f.Close()
+	c.dedup()
+	if err := e.save(cw.dir, c); err != nil {
+		return err
+	}
+	return os.Remove(cw.f.Name())
+}
+
+// chatWriter is the partial export of the chat, see Append.
+type chatWriter struct {
+	dir string
+	f   *os.File
+	enc *json.Encoder
+	// man is the media manifest, if the media download is enabled.
+	man *Manifest
+}
+
+// writer returns the partial export writer of the chat, opening it on the
+// first call.
+func (e *Exporter) writer(chat mtp.Entity) (*chatWriter, error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if cw, ok := e.writers[chat.GetID()]; ok {
+		return cw, nil
+	}
+	cw := &chatWriter{dir: e.chatDir(chat.GetID())}
+	if err := os.MkdirAll(cw.dir, 0o700); err != nil {
+		return nil, err
+	}
+	if e.dl != nil {
+		man, err := LoadManifest(cw.dir)
+		if err != nil {
+			return nil, err
+		}
+		cw.man = man
+	}
+	f, err := os.OpenFile(filepath.Join(cw.dir, partFile), os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0o600)
+	if err != nil {
+		return nil, err
+	}
+	cw.f, cw.enc = f, json.NewEncoder(f)
+	if e.writers == nil {
+		e.writers = make(map[int64]*chatWriter)
+	}
+	e.writers[chat.GetID()] = cw
+	return cw, nil
+}
+
+// save merges the chat c with the one previously exported to chatDir, and
+// writes it in the export format.
+func (e *Exporter) save(chatDir string, c Chat) error {
+	if prev, err := loadChat(filepath.Join(chatDir, resultFile)); err == nil {
+		c.Merge(prev)
+	} else if !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	if err := writeFile(filepath.Join(chatDir, resultFile), func(f *os.File) error {
+		return WriteJSON(f, c)
+	}); err != nil {
+		return err
+	}
+	if e.format == FormatHTML {
+		// JSON is kept, so that the messages of the next export are merged
+		// with these ones.
+		if err := writeFile(filepath.Join(chatDir, htmlFile), func(f *os.File) error {
+			return WriteHTML(f, c)
+		}); err != nil {
+			return err
+		}
+		return writeIndex(e.dir)
+	}
+	return nil
+}
+
+// chatDir returns the directory for the chat with id.
+func (e *Exporter) chatDir(id int64) string {
+	return filepath.Join(e.dir, strconv.FormatInt(id, 10))
+}
+
+func loadChat(filename string) (Chat, error) {
+	f, err := os.Open(filename)
+	if err != nil {
+		return Chat{}, err
+	}
+	defer f.Close()
+	return ReadJSON(f)
+}
+
+// writeFile writes the file using the function fn.  The data is written to
+// a temporary file first, which is then renamed, so that the existing file
+// is not lost if the write fails.
+func writeFile(filename string, fn func(f *os.File) error) error {
+	f, err := os.CreateTemp(filepath.Dir(filename), filepath.Base(filename)+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+	if err := fn(f); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	return os.Rename(f.Name(), filename)
+}
@@ -0,0 +1,67 @@
+package export
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+
+	"github.com/gotd/td/telegram/query/messages"
+	"github.com/gotd/td/tg"
+)
+
+func TestExporter_Append(t *testing.T) {
+	dir := t.TempDir()
+	chatDir := filepath.Join(dir, "1")
+	chat := &tg.Chat{ID: 1, Title: "test"}
+	msg := func(id int) messages.Elem {
+		return messages.Elem{Msg: &tg.Message{ID: id, Message: "hello"}}
+	}
+	ctx := context.Background()
+
+	// the chat was exported before.
+	if err := New(dir).Export(ctx, chat, []messages.Elem{msg(1)}); err != nil {
+		t.Fatal(err)
+	}
+
+	e := New(dir, WithFormat(FormatHTML))
+	for _, batch := range [][]messages.Elem{{msg(30), msg(20)}, {msg(10)}} {
+		if err := e.Append(ctx, chat, batch); err != nil {
+			t.Fatalf("Append() error = %v", err)
+		}
+	}
+	// nothing is rendered until the chat is finished.
+	if _, err := os.Stat(filepath.Join(chatDir, htmlFile)); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("the chat page was rendered before Finish: %v", err)
+	}
+	if c, _ := loadChat(filepath.Join(chatDir, resultFile)); len(c.Messages) != 1 {
+		t.Errorf("result.json was rewritten before Finish: %d messages", len(c.Messages))
+	}
+
+	if err := e.Finish(chat); err != nil {
+		t.Fatalf("Finish() error = %v", err)
+	}
+	c, err := loadChat(filepath.Join(chatDir, resultFile))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []int
+	for _, m := range c.Messages {
+		got = append(got, m.ID)
+	}
+	if want := []int{1, 10, 20, 30}; !slices.Equal(got, want) {
+		t.Errorf("exported messages = %v, want %v", got, want)
+	}
+	if _, err := os.Stat(filepath.Join(chatDir, partFile)); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("the partial export was not removed: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "index.html")); err != nil {
+		t.Errorf("index: %v", err)
+	}
+	// the chat with nothing appended is not exported.
+	if err := e.Finish(&tg.Chat{ID: 2}); err != nil {
+		t.Errorf("Finish() error = %v", err)
+	}
+}
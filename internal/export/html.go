@@ -0,0 +1,151 @@
+package export
+
+import (
+	"html"
+	"html/template"
+	"io"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// htmlFile is the name of the HTML page in the chat directory.
+const htmlFile = "messages.html"
+
+const css = `body{font-family:sans-serif;max-width:50em;margin:0 auto;padding:1em;background:#fafafa;color:#222}
+.msg{background:#fff;border:1px solid #ddd;border-radius:6px;padding:.5em .8em;margin:.6em 0}
+.hdr{color:#777;font-size:.85em;margin-bottom:.3em}
+.hdr a{color:#777}
+.text{white-space:pre-wrap;overflow-wrap:anywhere}
+.fwd,.reply{color:#2a6;font-size:.85em}
+.media img,.media video{max-width:100%;max-height:30em}
+.spoiler{background:#ccc}
+pre,code{background:#eee}
+table{border-collapse:collapse}td,th{padding:.3em .8em;border-bottom:1px solid #ddd;text-align:left}`
+
+var chatTmpl = template.Must(template.New("chat").Funcs(template.FuncMap{
+	"text":    renderText,
+	"isImage": func(mime string) bool { return strings.HasPrefix(mime, "image/") },
+	"isVideo": func(mime string) bool { return strings.HasPrefix(mime, "video/") },
+	"isAudio": func(mime string) bool { return strings.HasPrefix(mime, "audio/") },
+}).Parse(`<!DOCTYPE html>
+<html><head><meta charset="utf-8"><title>{{.Name}}</title><style>` + css + `</style></head>
+<body>
+<p><a href="../index.html">&larr; All chats</a></p>
+<h1>{{.Name}}</h1>
+<p>{{.Type}}, ID {{.ID}}, {{len .Messages}} messages</p>
+{{range .Messages}}<div class="msg" id="msg-{{.ID}}">
+<div class="hdr"><a href="#msg-{{.ID}}">#{{.ID}}</a> {{.Date}}{{with .From}} &middot; {{.}}{{end}}{{with .Edited}} &middot; edited {{.}}{{end}}</div>
+{{with .ForwardedFrom}}<div class="fwd">Forwarded from {{.}}</div>{{end}}
+{{with .ReplyToMessageID}}<div class="reply">In reply to <a href="#msg-{{.}}">#{{.}}</a></div>{{end}}
+{{if .Photo}}<div class="media"><a href="{{.Photo}}"><img src="{{.Photo}}" alt="photo"></a></div>
+{{else if .File}}<div class="media">{{if isImage .MimeType}}<a href="{{.File}}"><img src="{{.File}}" alt="{{.MediaType}}"></a>{{else if isVideo .MimeType}}<video controls src="{{.File}}"></video>{{else if isAudio .MimeType}}<audio controls src="{{.File}}"></audio>{{else}}<a href="{{.File}}">{{.File}}</a>{{end}}</div>
+{{else if .MediaType}}<div class="media">[{{.MediaType}}]</div>
+{{end}}<div class="text">{{text .TextEntities}}</div>
+</div>
+{{end}}</body></html>
+`))
+
+var indexTmpl = template.Must(template.New("index").Parse(`<!DOCTYPE html>
+<html><head><meta charset="utf-8"><title>Wiped chats</title><style>` + css + `</style></head>
+<body>
+<h1>Wiped chats</h1>
+<table>
+<tr><th>Chat</th><th>Type</th><th>ID</th><th>Messages</th></tr>
+{{range .}}<tr><td><a href="{{.ID}}/` + htmlFile + `">{{.Name}}</a></td><td>{{.Type}}</td><td>{{.ID}}</td><td>{{len .Messages}}</td></tr>
+{{end}}</table>
+</body></html>
+`))
+
+// WriteHTML writes the chat as the HTML page to w.  The media links are
+// relative to the chat directory.
+func WriteHTML(w io.Writer, c Chat) error {
+	return chatTmpl.Execute(w, c)
+}
+
+// writeIndex writes the index page, that lists all exported chats in the
+// directory dir.
+func writeIndex(dir string) error {
+	matches, err := filepath.Glob(filepath.Join(dir, "*", resultFile))
+	if err != nil {
+		return err
+	}
+	var chats = make([]Chat, 0, len(matches))
+	for _, m := range matches {
+		if _, err := os.Stat(filepath.Join(filepath.Dir(m), htmlFile)); err != nil {
+			// exported as JSON only.
+			continue
+		}
+		c, err := loadChat(m)
+		if err != nil {
+			return err
+		}
+		chats = append(chats, c)
+	}
+	sort.Slice(chats, func(i, j int) bool {
+		return chats[i].Name < chats[j].Name
+	})
+	return writeFile(filepath.Join(dir, "index.html"), func(f *os.File) error {
+		return indexTmpl.Execute(f, chats)
+	})
+}
+
+// renderText renders the text entities as HTML.
+func renderText(ents []TextEntity) template.HTML {
+	var sb strings.Builder
+	for _, e := range ents {
+		text := html.EscapeString(e.Text)
+		switch e.Type {
+		case "bold":
+			sb.WriteString("<b>" + text + "</b>")
+		case "italic":
+			sb.WriteString("<i>" + text + "</i>")
+		case "underline":
+			sb.WriteString("<u>" + text + "</u>")
+		case "strikethrough":
+			sb.WriteString("<s>" + text + "</s>")
+		case "code":
+			sb.WriteString("<code>" + text + "</code>")
+		case "pre":
+			sb.WriteString("<pre>" + text + "</pre>")
+		case "blockquote":
+			sb.WriteString("<blockquote>" + text + "</blockquote>")
+		case "spoiler":
+			sb.WriteString(`<span class="spoiler">` + text + "</span>")
+		case "link":
+			sb.WriteString(link(e.Text, text))
+		case "text_link":
+			sb.WriteString(link(e.Href, text))
+		case "email":
+			sb.WriteString(link("mailto:"+e.Text, text))
+		case "mention":
+			sb.WriteString(link("https://t.me/"+strings.TrimPrefix(e.Text, "@"), text))
+		case "mention_name":
+			sb.WriteString(link("tg://user?id="+strconv.FormatInt(e.UserID, 10), text))
+		default:
+			sb.WriteString(text)
+		}
+	}
+	return template.HTML(sb.String())
+}
+
+// link returns the HTML link to href with the (escaped) text.  Links with
+// schemes other than http, https, mailto and tg are rendered as text.
+func link(href string, text string) string {
+	if !strings.Contains(href, "://") && !strings.HasPrefix(href, "mailto:") {
+		href = "https://" + href
+	}
+	u, err := url.Parse(href)
+	if err != nil {
+		return text
+	}
+	switch u.Scheme {
+	case "http", "https", "mailto", "tg":
+	default:
+		return text
+	}
+	return `<a href="` + html.EscapeString(u.String()) + `">` + text + "</a>"
+}
@@ -0,0 +1,56 @@
+package export
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/gotd/td/telegram/query/messages"
+	"github.com/gotd/td/tg"
+)
+
+func Test_renderText(t *testing.T) {
+	tests := []struct {
+		name string
+		ents []TextEntity
+		want string
+	}{
+		{"escapes plain text", []TextEntity{{Type: "plain", Text: "<script>"}}, "&lt;script&gt;"},
+		{"bold", []TextEntity{{Type: "bold", Text: "a&b"}}, "<b>a&amp;b</b>"},
+		{"link without scheme", []TextEntity{{Type: "link", Text: "example.com"}}, `<a href="https://example.com">example.com</a>`},
+		{"javascript link is text", []TextEntity{{Type: "text_link", Text: "x", Href: "javascript:alert(1)"}}, "x"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := string(renderText(tt.ents)); got != tt.want {
+				t.Errorf("renderText() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestExporter_html(t *testing.T) {
+	dir := t.TempDir()
+	e := New(dir, WithFormat(FormatHTML))
+	chat := &tg.Chat{ID: 1, Title: "<Chat>"}
+	msgs := []messages.Elem{{Msg: &tg.Message{ID: 10, Message: "hello"}}}
+	if err := e.Export(context.Background(), chat, msgs); err != nil {
+		t.Fatalf("Export() error = %v", err)
+	}
+	page, err := os.ReadFile(filepath.Join(dir, "1", htmlFile))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(page), `id="msg-10"`) || !strings.Contains(string(page), "&lt;Chat&gt;") {
+		t.Errorf("unexpected chat page:\n%s", page)
+	}
+	index, err := os.ReadFile(filepath.Join(dir, "index.html"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(index), `href="1/messages.html"`) {
+		t.Errorf("chat is missing from the index:\n%s", index)
+	}
+}
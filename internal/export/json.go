@@ -0,0 +1,403 @@
+// Package export saves the messages before they are deleted.  The JSON format
+// is close to the Telegram Desktop "result.json", so that the existing tools
+// can read it.
+package export
+
+import (
+	"encoding/json"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf16"
+
+	"github.com/gotd/td/telegram/query/messages"
+	"github.com/gotd/td/tg"
+	mtp "github.com/rusq/mtpwrap"
+)
+
+// dateLayout is the date layout used by Telegram Desktop.
+const dateLayout = "2006-01-02T15:04:05"
+
+// Chat is the exported chat.
+type Chat struct {
+	Name     string    `json:"name"`
+	Type     string    `json:"type"`
+	ID       int64     `json:"id"`
+	Messages []Message `json:"messages"`
+}
+
+// Message is the exported message.
+type Message struct {
+	ID               int          `json:"id"`
+	Type             string       `json:"type"`
+	Date             string       `json:"date"`
+	DateUnixtime     string       `json:"date_unixtime"`
+	Edited           string       `json:"edited,omitempty"`
+	EditedUnixtime   string       `json:"edited_unixtime,omitempty"`
+	From             string       `json:"from,omitempty"`
+	FromID           string       `json:"from_id,omitempty"`
+	ForwardedFrom    string       `json:"forwarded_from,omitempty"`
+	ReplyToMessageID int          `json:"reply_to_message_id,omitempty"`
+	MediaType        string       `json:"media_type,omitempty"`
+	MimeType         string       `json:"mime_type,omitempty"`
+	Photo            string       `json:"photo,omitempty"`
+	File             string       `json:"file,omitempty"`
+	Text             any          `json:"text"`
+	TextEntities     []TextEntity `json:"text_entities"`
+}
+
+// TextEntity is the part of the message text, i.e. plain text, bold, or link.
+type TextEntity struct {
+	Type       string `json:"type"`
+	Text       string `json:"text"`
+	Href       string `json:"href,omitempty"`
+	UserID     int64  `json:"user_id,omitempty"`
+	Language   string `json:"language,omitempty"`
+	DocumentID string `json:"document_id,omitempty"`
+}
+
+// NewChat converts the chat and its messages msgs to the exported chat.
+func NewChat(chat mtp.Entity, msgs []messages.Elem) Chat {
+	c := Chat{
+		Name:     chat.GetTitle(),
+		Type:     chatType(chat),
+		ID:       chat.GetID(),
+		Messages: make([]Message, 0, len(msgs)),
+	}
+	for _, m := range msgs {
+		c.Messages = append(c.Messages, NewMessage(m))
+	}
+	c.sort()
+	return c
+}
+
+// Merge adds the messages from other, that are not yet in c.  It allows to
+// keep all exported messages, when the chat is exported more than once.
+func (c *Chat) Merge(other Chat) {
+	seen := make(map[int]bool, len(c.Messages))
+	for _, m := range c.Messages {
+		seen[m.ID] = true
+	}
+	for _, m := range other.Messages {
+		if !seen[m.ID] {
+			c.Messages = append(c.Messages, m)
+		}
+	}
+	c.sort()
+}
+
+// setMedia sets the paths of the downloaded media files from the manifest.
+func (c *Chat) setMedia(man *Manifest) {
+	for i := range c.Messages {
+		mf, ok := man.Files[c.Messages[i].ID]
+		if !ok {
+			continue
+		}
+		if mf.Photo {
+			c.Messages[i].Photo = mf.Path
+		} else {
+			c.Messages[i].File = mf.Path
+		}
+	}
+}
+
+// dedup removes the duplicate messages, keeping the last copy of each, and
+// sorts the messages.
+func (c *Chat) dedup() {
+	idx := make(map[int]int, len(c.Messages))
+	ret := c.Messages[:0]
+	for _, m := range c.Messages {
+		if i, ok := idx[m.ID]; ok {
+			ret[i] = m
+			continue
+		}
+		idx[m.ID] = len(ret)
+		ret = append(ret, m)
+	}
+	c.Messages = ret
+	c.sort()
+}
+
+func (c *Chat) sort() {
+	sort.Slice(c.Messages, func(i, j int) bool {
+		return c.Messages[i].ID < c.Messages[j].ID
+	})
+}
+
+// WriteJSON writes the chat to w.
+func WriteJSON(w io.Writer, c Chat) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", " ")
+	return enc.Encode(c)
+}
+
+// ReadJSON reads the chat from r.
+func ReadJSON(r io.Reader) (Chat, error) {
+	var c Chat
+	if err := json.NewDecoder(r).Decode(&c); err != nil {
+		return Chat{}, err
+	}
+	return c, nil
+}
+
+// NewMessage converts the message element m to the exported message.
+func NewMessage(m messages.Elem) Message {
+	ret := Message{
+		ID:           m.Msg.GetID(),
+		Type:         "message",
+		TextEntities: []TextEntity{},
+	}
+	setDate(&ret.Date, &ret.DateUnixtime, m.Msg.GetDate())
+	if from, ok := m.Msg.GetFromID(); ok {
+		ret.FromID = peerID(from)
+		ret.From = peerName(m, from)
+	}
+	if hdr, ok := m.Msg.GetReplyTo(); ok {
+		if rh, ok := hdr.(*tg.MessageReplyHeader); ok {
+			ret.ReplyToMessageID = rh.ReplyToMsgID
+		}
+	}
+
+	msg, ok := m.Msg.(*tg.Message)
+	if !ok {
+		ret.Type = "service"
+		ret.Text = ""
+		return ret
+	}
+	if date, ok := msg.GetEditDate(); ok {
+		setDate(&ret.Edited, &ret.EditedUnixtime, date)
+	}
+	if fwd, ok := msg.GetFwdFrom(); ok {
+		ret.ForwardedFrom = fwdName(m, fwd)
+	}
+	ret.MediaType, ret.MimeType = mediaType(msg.Media)
+	ret.TextEntities = textEntities(msg.Message, msg.Entities)
+	ret.Text = text(ret.TextEntities)
+	return ret
+}
+
+func setDate(date, unixtime *string, ts int) {
+	*date = time.Unix(int64(ts), 0).Format(dateLayout)
+	*unixtime = strconv.Itoa(ts)
+}
+
+// chatType returns the Telegram Desktop chat type.
+func chatType(chat mtp.Entity) string {
+	var public bool
+	if ch, ok := chat.(*tg.Channel); ok {
+		_, public = ch.GetUsername()
+	}
+	var kind string
+	switch mtp.DlgType(chat) {
+	case mtp.DGroup:
+		return "private_group"
+	case mtp.DChannel:
+		kind = "channel"
+	default:
+		kind = "supergroup"
+	}
+	if public {
+		return "public_" + kind
+	}
+	return "private_" + kind
+}
+
+// peerID returns the Telegram Desktop representation of the peer ID,
+// i.e. "user12345".
+func peerID(p tg.PeerClass) string {
+	switch p := p.(type) {
+	case *tg.PeerUser:
+		return "user" + strconv.FormatInt(p.UserID, 10)
+	case *tg.PeerChat:
+		return "chat" + strconv.FormatInt(p.ChatID, 10)
+	case *tg.PeerChannel:
+		return "channel" + strconv.FormatInt(p.ChannelID, 10)
+	}
+	return ""
+}
+
+// peerName returns the name of the peer, if it is known.
+func peerName(m messages.Elem, p tg.PeerClass) string {
+	switch p := p.(type) {
+	case *tg.PeerUser:
+		if u, ok := m.Entities.User(p.UserID); ok {
+			return strings.TrimSpace(u.FirstName + " " + u.LastName)
+		}
+	case *tg.PeerChat:
+		if c, ok := m.Entities.Chat(p.ChatID); ok {
+			return c.Title
+		}
+	case *tg.PeerChannel:
+		if c, ok := m.Entities.Channel(p.ChannelID); ok {
+			return c.Title
+		}
+	}
+	return ""
+}
+
+// fwdName returns the name of the original author of the forwarded message.
+func fwdName(m messages.Elem, fwd tg.MessageFwdHeader) string {
+	if fwd.FromName != "" {
+		return fwd.FromName
+	}
+	if from, ok := fwd.GetFromID(); ok {
+		if name := peerName(m, from); name != "" {
+			return name
+		}
+		return peerID(from)
+	}
+	return ""
+}
+
+// mediaType returns the Telegram Desktop media type and MIME type of the
+// document.
+func mediaType(media tg.MessageMediaClass) (string, string) {
+	md, ok := media.(*tg.MessageMediaDocument)
+	if !ok {
+		return "", ""
+	}
+	doc, ok := md.Document.AsNotEmpty()
+	if !ok {
+		return "", ""
+	}
+	var kind string
+	for _, attr := range doc.Attributes {
+		switch a := attr.(type) {
+		case *tg.DocumentAttributeSticker:
+			return "sticker", doc.MimeType
+		case *tg.DocumentAttributeAnimated:
+			return "animation", doc.MimeType
+		case *tg.DocumentAttributeVideo:
+			if a.RoundMessage {
+				kind = "video_message"
+			} else {
+				kind = "video_file"
+			}
+		case *tg.DocumentAttributeAudio:
+			if a.Voice {
+				kind = "voice_message"
+			} else {
+				kind = "audio_file"
+			}
+		}
+	}
+	return kind, doc.MimeType
+}
+
+// textEntities splits the text into the text entities.  Offsets of the
+// telegram entities are in UTF-16 code units.  Nested entities are not
+// supported, only the outermost one is kept.
+func textEntities(s string, ents []tg.MessageEntityClass) []TextEntity {
+	var ret = []TextEntity{}
+	if s == "" {
+		return ret
+	}
+	u := utf16.Encode([]rune(s))
+	sorted := make([]tg.MessageEntityClass, len(ents))
+	copy(sorted, ents)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return sorted[i].GetOffset() < sorted[j].GetOffset()
+	})
+
+	pos := 0
+	for _, e := range sorted {
+		start, end := e.GetOffset(), e.GetOffset()+e.GetLength()
+		if start < pos || start >= len(u) {
+			continue
+		}
+		if end > len(u) {
+			end = len(u)
+		}
+		if start > pos {
+			ret = append(ret, TextEntity{Type: "plain", Text: string(utf16.Decode(u[pos:start]))})
+		}
+		ret = append(ret, newTextEntity(e, string(utf16.Decode(u[start:end]))))
+		pos = end
+	}
+	if pos < len(u) {
+		ret = append(ret, TextEntity{Type: "plain", Text: string(utf16.Decode(u[pos:]))})
+	}
+	return ret
+}
+
+func newTextEntity(e tg.MessageEntityClass, text string) TextEntity {
+	te := TextEntity{Text: text}
+	switch e := e.(type) {
+	case *tg.MessageEntityMention:
+		te.Type = "mention"
+	case *tg.MessageEntityHashtag:
+		te.Type = "hashtag"
+	case *tg.MessageEntityBotCommand:
+		te.Type = "bot_command"
+	case *tg.MessageEntityURL:
+		te.Type = "link"
+	case *tg.MessageEntityEmail:
+		te.Type = "email"
+	case *tg.MessageEntityBold:
+		te.Type = "bold"
+	case *tg.MessageEntityItalic:
+		te.Type = "italic"
+	case *tg.MessageEntityCode:
+		te.Type = "code"
+	case *tg.MessageEntityPre:
+		te.Type = "pre"
+		te.Language = e.Language
+	case *tg.MessageEntityTextURL:
+		te.Type = "text_link"
+		te.Href = e.URL
+	case *tg.MessageEntityMentionName:
+		te.Type = "mention_name"
+		te.UserID = e.UserID
+	case *tg.MessageEntityPhone:
+		te.Type = "phone"
+	case *tg.MessageEntityCashtag:
+		te.Type = "cashtag"
+	case *tg.MessageEntityUnderline:
+		te.Type = "underline"
+	case *tg.MessageEntityStrike:
+		te.Type = "strikethrough"
+	case *tg.MessageEntityBankCard:
+		te.Type = "bank_card"
+	case *tg.MessageEntitySpoiler:
+		te.Type = "spoiler"
+	case *tg.MessageEntityCustomEmoji:
+		te.Type = "custom_emoji"
+		te.DocumentID = strconv.FormatInt(e.DocumentID, 10)
+	case *tg.MessageEntityBlockquote:
+		te.Type = "blockquote"
+	default:
+		te.Type = "unknown"
+	}
+	return te
+}
+
+// text returns the Telegram Desktop representation of the message text: a
+// string, if the text is plain, or the list of strings and text entities
+// otherwise.
+func text(ents []TextEntity) any {
+	var plain = true
+	for _, e := range ents {
+		if e.Type != "plain" {
+			plain = false
+			break
+		}
+	}
+	if plain {
+		var sb strings.Builder
+		for _, e := range ents {
+			sb.WriteString(e.Text)
+		}
+		return sb.String()
+	}
+	ret := make([]any, len(ents))
+	for i, e := range ents {
+		if e.Type == "plain" {
+			ret[i] = e.Text
+		} else {
+			ret[i] = e
+		}
+	}
+	return ret
+}
@@ -0,0 +1,83 @@
+package export
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/gotd/td/tg"
+)
+
+func Test_textEntities(t *testing.T) {
+	tests := []struct {
+		name string
+		s    string
+		ents []tg.MessageEntityClass
+		want []TextEntity
+	}{
+		{
+			name: "empty",
+			want: []TextEntity{},
+		},
+		{
+			name: "plain text",
+			s:    "hello",
+			want: []TextEntity{{Type: "plain", Text: "hello"}},
+		},
+		{
+			name: "entities",
+			s:    "see https://example.com now",
+			ents: []tg.MessageEntityClass{
+				&tg.MessageEntityURL{Offset: 4, Length: 19},
+				&tg.MessageEntityBold{Offset: 24, Length: 3},
+			},
+			want: []TextEntity{
+				{Type: "plain", Text: "see "},
+				{Type: "link", Text: "https://example.com"},
+				{Type: "plain", Text: " "},
+				{Type: "bold", Text: "now"},
+			},
+		},
+		{
+			name: "utf-16 offsets",
+			s:    "😀 bold",
+			ents: []tg.MessageEntityClass{&tg.MessageEntityBold{Offset: 3, Length: 4}},
+			want: []TextEntity{
+				{Type: "plain", Text: "😀 "},
+				{Type: "bold", Text: "bold"},
+			},
+		},
+		{
+			name: "nested entity is skipped",
+			s:    "abc",
+			ents: []tg.MessageEntityClass{
+				&tg.MessageEntityBold{Offset: 0, Length: 3},
+				&tg.MessageEntityItalic{Offset: 1, Length: 1},
+			},
+			want: []TextEntity{{Type: "bold", Text: "abc"}},
+		},
+		{
+			name: "text link",
+			s:    "here",
+			ents: []tg.MessageEntityClass{&tg.MessageEntityTextURL{Offset: 0, Length: 4, URL: "https://t.me"}},
+			want: []TextEntity{{Type: "text_link", Text: "here", Href: "https://t.me"}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := textEntities(tt.s, tt.ents); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("textEntities() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_text(t *testing.T) {
+	if got := text([]TextEntity{{Type: "plain", Text: "a"}, {Type: "plain", Text: "b"}}); got != "ab" {
+		t.Errorf("text() = %v, want %q", got, "ab")
+	}
+	got := text([]TextEntity{{Type: "plain", Text: "a"}, {Type: "bold", Text: "b"}})
+	want := []any{"a", TextEntity{Type: "bold", Text: "b"}}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("text() = %v, want %v", got, want)
+	}
+}
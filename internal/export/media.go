@@ -0,0 +1,161 @@
+package export
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/gotd/td/telegram/query/messages"
+	"github.com/gotd/td/tg"
+)
+
+const (
+	// mediaDir is the name of the media directory in the chat directory.
+	mediaDir = "media"
+	// manifestFile is the name of the media manifest file.
+	manifestFile = "manifest.json"
+)
+
+// Downloader downloads the file at location loc to w.
+type Downloader interface {
+	Download(ctx context.Context, loc tg.InputFileLocationClass, w io.Writer) error
+}
+
+// Manifest maps the message IDs to the downloaded media files.
+type Manifest struct {
+	Files map[int]MediaFile `json:"files"`
+}
+
+// MediaFile is the downloaded media file.
+type MediaFile struct {
+	// Path is the path of the file, relative to the chat directory.
+	Path     string `json:"path"`
+	Size     int64  `json:"size"`
+	MimeType string `json:"mime_type,omitempty"`
+	// Photo is true if the file is a photo, and not a document.
+	Photo bool `json:"photo,omitempty"`
+}
+
+// LoadManifest loads the media manifest of the chat directory chatDir.  If
+// there's no manifest, an empty manifest is returned.
+func LoadManifest(chatDir string) (*Manifest, error) {
+	m := &Manifest{Files: make(map[int]MediaFile)}
+	f, err := os.Open(filepath.Join(chatDir, mediaDir, manifestFile))
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return m, nil
+		}
+		return nil, err
+	}
+	defer f.Close()
+	if err := json.NewDecoder(f).Decode(m); err != nil {
+		return nil, fmt.Errorf("invalid manifest: %w", err)
+	}
+	if m.Files == nil {
+		m.Files = make(map[int]MediaFile)
+	}
+	return m, nil
+}
+
+func (m *Manifest) save(chatDir string) error {
+	return writeFile(filepath.Join(chatDir, mediaDir, manifestFile), func(f *os.File) error {
+		enc := json.NewEncoder(f)
+		enc.SetIndent("", " ")
+		return enc.Encode(m)
+	})
+}
+
+// has returns true if the media file of the message with id was downloaded
+// and is present on disk.
+func (m *Manifest) has(chatDir string, id int) bool {
+	mf, ok := m.Files[id]
+	if !ok {
+		return false
+	}
+	fi, err := os.Stat(filepath.Join(chatDir, filepath.FromSlash(mf.Path)))
+	return err == nil && fi.Size() == mf.Size
+}
+
+// downloadMedia downloads the media files of the messages msgs to the media
+// directory of the chat, and adds them to the manifest man.  The files that
+// are already in the manifest are skipped, and the manifest is saved after
+// each file, so that the download can be resumed, if interrupted.
+func (e *Exporter) downloadMedia(ctx context.Context, chatDir string, man *Manifest, msgs []messages.Elem) error {
+	if err := os.MkdirAll(filepath.Join(chatDir, mediaDir), 0o700); err != nil {
+		return err
+	}
+	for _, m := range msgs {
+		file, ok := m.File()
+		if !ok {
+			continue
+		}
+		id := m.Msg.GetID()
+		if man.has(chatDir, id) {
+			continue
+		}
+		rel := mediaDir + "/" + strconv.Itoa(id) + "_" + sanitize(file.Name)
+		size, err := e.download(ctx, filepath.Join(chatDir, filepath.FromSlash(rel)), file.Location)
+		if err != nil {
+			return fmt.Errorf("message %d: failed to download %s: %w", id, file.Name, err)
+		}
+		man.Files[id] = MediaFile{Path: rel, Size: size, MimeType: file.MIMEType, Photo: isPhoto(m)}
+		if err := man.save(chatDir); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// download downloads the file at loc to filename.  The file is written under
+// a temporary name and renamed once the download is complete.  It returns
+// the size of the file.
+func (e *Exporter) download(ctx context.Context, filename string, loc tg.InputFileLocationClass) (int64, error) {
+	part := filename + ".part"
+	f, err := os.Create(part)
+	if err != nil {
+		return 0, err
+	}
+	defer os.Remove(part)
+	if err := e.dl.Download(ctx, loc, f); err != nil {
+		f.Close()
+		return 0, err
+	}
+	fi, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return 0, err
+	}
+	if err := f.Close(); err != nil {
+		return 0, err
+	}
+	return fi.Size(), os.Rename(part, filename)
+}
+
+func isPhoto(m messages.Elem) bool {
+	_, ok := m.Photo()
+	return ok
+}
+
+// sanitize makes the file name safe to use on any file system.
+func sanitize(name string) string {
+	name = strings.Map(func(r rune) rune {
+		switch r {
+		case '/', '\\', ':', '*', '?', '"', '<', '>', '|':
+			return '_'
+		}
+		if r < 0x20 {
+			return '_'
+		}
+		return r
+	}, filepath.Base(name))
+	if name == "" || name == "." || name == ".." {
+		return "file"
+	}
+	return name
+}
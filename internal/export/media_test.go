@@ -0,0 +1,82 @@
+package export
+
+import (
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/gotd/td/telegram/query/messages"
+	"github.com/gotd/td/tg"
+)
+
+type fakeDownloader struct {
+	calls int
+}
+
+func (fd *fakeDownloader) Download(_ context.Context, _ tg.InputFileLocationClass, w io.Writer) error {
+	fd.calls++
+	_, err := io.WriteString(w, "file contents")
+	return err
+}
+
+func docMsg(id int, name string) messages.Elem {
+	return messages.Elem{Msg: &tg.Message{
+		ID:   id,
+		Date: 1600000000,
+		Media: &tg.MessageMediaDocument{
+			Document: &tg.Document{
+				ID:         int64(id),
+				MimeType:   "application/pdf",
+				Attributes: []tg.DocumentAttributeClass{&tg.DocumentAttributeFilename{FileName: name}},
+			},
+		},
+	}}
+}
+
+func TestExporter_media(t *testing.T) {
+	dir := t.TempDir()
+	fd := &fakeDownloader{}
+	e := New(dir, WithMedia(fd))
+	chat := &tg.Chat{ID: 1, Title: "test"}
+
+	msgs := []messages.Elem{docMsg(10, "report.pdf"), {Msg: &tg.Message{ID: 11, Message: "text"}}}
+	if err := e.Export(context.Background(), chat, msgs); err != nil {
+		t.Fatalf("Export() error = %v", err)
+	}
+	if fd.calls != 1 {
+		t.Errorf("downloads = %d, want 1", fd.calls)
+	}
+	data, err := os.ReadFile(filepath.Join(dir, "1", "media", "10_report.pdf"))
+	if err != nil {
+		t.Fatalf("media file: %v", err)
+	}
+	if string(data) != "file contents" {
+		t.Errorf("media file contents = %q", data)
+	}
+
+	// second export must skip the downloaded file.
+	msgs = append(msgs, docMsg(12, "../../evil.pdf"))
+	if err := e.Export(context.Background(), chat, msgs); err != nil {
+		t.Fatalf("Export() error = %v", err)
+	}
+	if fd.calls != 2 {
+		t.Errorf("downloads = %d, want 2", fd.calls)
+	}
+	man, err := LoadManifest(filepath.Join(dir, "1"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := man.Files[12].Path; got != "media/12_evil.pdf" {
+		t.Errorf("manifest path = %q, want %q", got, "media/12_evil.pdf")
+	}
+
+	c, err := loadChat(filepath.Join(dir, "1", resultFile))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(c.Messages) != 3 || c.Messages[0].File != "media/10_report.pdf" {
+		t.Errorf("exported messages = %+v", c.Messages)
+	}
+}
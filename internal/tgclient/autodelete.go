@@ -0,0 +1,89 @@
+package tgclient
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/gotd/contrib/storage"
+	"github.com/gotd/td/tg"
+	mtp "github.com/rusq/mtpwrap"
+)
+
+// User is the private chat with the user.  It wraps tg.User to satisfy the
+// mtpwrap Entity interface.
+type User struct {
+	*tg.User
+}
+
+// GetTitle returns the name of the user.
+func (u User) GetTitle() string {
+	name := strings.TrimSpace(u.FirstName + " " + u.LastName)
+	if name == "" {
+		name = "@" + u.Username
+	}
+	return name
+}
+
+// GetDialogs returns the private chats with the users, and the chats and
+// channels.  Deleted accounts and the "Saved Messages" chat are skipped.
+func (c *Client) GetDialogs(ctx context.Context) ([]mtp.Entity, error) {
+	return c.GetEntities(ctx, func(peer storage.Peer) (mtp.Entity, bool) {
+		switch {
+		case peer.User != nil:
+			if peer.User.Self || peer.User.Deleted {
+				return nil, false
+			}
+			return User{peer.User}, true
+		case peer.Chat != nil:
+			return peer.Chat, true
+		case peer.Channel != nil:
+			return peer.Channel, true
+		}
+		return nil, false
+	})
+}
+
+// HistoryTTL returns the auto-delete period of the chat, zero if it's not
+// set.
+func (c *Client) HistoryTTL(ctx context.Context, chat mtp.Entity) (time.Duration, error) {
+	var period int
+	switch e := chat.(type) {
+	case User:
+		full, err := c.API().UsersGetFullUser(ctx, e.AsInput())
+		if err != nil {
+			return 0, err
+		}
+		period, _ = full.FullUser.GetTTLPeriod()
+	case *tg.Chat:
+		full, err := c.API().MessagesGetFullChat(ctx, e.ID)
+		if err != nil {
+			return 0, err
+		}
+		period, _ = full.FullChat.GetTTLPeriod()
+	case *tg.Channel:
+		full, err := c.API().ChannelsGetFullChannel(ctx, e.AsInput())
+		if err != nil {
+			return 0, err
+		}
+		period, _ = full.FullChat.GetTTLPeriod()
+	default:
+		return 0, fmt.Errorf("unsupported chat type: %T", chat)
+	}
+	return time.Duration(period) * time.Second, nil
+}
+
+// SetHistoryTTL sets the auto-delete period of the chat, zero period turns
+// the auto-delete off.
+func (c *Client) SetHistoryTTL(ctx context.Context, chat mtp.Entity, period time.Duration) error {
+	peer, err := inputPeer(chat)
+	if err != nil {
+		return err
+	}
+	_, err = c.API().MessagesSetHistoryTTL(ctx, &tg.MessagesSetHistoryTTLRequest{
+		Peer:   peer,
+		Period: int(period / time.Second),
+	})
+	return err
+}
@@ -0,0 +1,193 @@
+// Package tgclient extends the mtpwrap client with the Telegram API calls that
+// mtpwrap does not provide.
+package tgclient
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"iter"
+	"time"
+
+	"github.com/gotd/td/telegram/downloader"
+	"github.com/gotd/td/telegram/query/dialogs"
+	"github.com/gotd/td/telegram/query/messages"
+	"github.com/gotd/td/tg"
+	mtp "github.com/rusq/mtpwrap"
+)
+
+// Client is the mtpwrap client with extensions.
+type Client struct {
+	*mtp.Client
+	dl *downloader.Downloader
+}
+
+// New wraps the mtpwrap client cl.
+func New(cl *mtp.Client) *Client {
+	return &Client{
+		Client: cl,
+		dl:     downloader.NewDownloader(),
+	}
+}
+
+// API returns the raw Telegram API client.
+func (c *Client) API() *tg.Client {
+	return c.Client.Client().API()
+}
+
+// Download downloads the file at location loc to w.
+func (c *Client) Download(ctx context.Context, loc tg.InputFileLocationClass, w io.Writer) error {
+	_, err := c.dl.Download(c.API(), loc).Stream(ctx, w)
+	return err
+}
+
+// scanBatch is the number of the messages requested at once by
+// IterMyMessages.
+const scanBatch = 100
+
+// IterMyMessages returns the iterator over the messages of the current user
+// in the chat dlg, newest first.  If offsetID is not zero, the iteration
+// starts with the message older than offsetID.  If before is not zero, the
+// search starts at this date, so the newer messages are not requested.
+// Unlike the mtpwrap search, the result is not cached, so that the repeated
+// scans of the same chat, i.e. in the daemon mode, find the new messages.
+func (c *Client) IterMyMessages(ctx context.Context, dlg mtp.Entity, offsetID int, before time.Time) iter.Seq2[messages.Elem, error] {
+	return c.IterMyMessagesPaged(ctx, dlg, offsetID, before, func(_ context.Context, request func() error) error {
+		return request()
+	})
+}
+
+// IterMyMessagesPaged is IterMyMessages, that requests each page of the
+// messages by calling do with the function that makes the request, i.e. to
+// pace the requests.
+func (c *Client) IterMyMessagesPaged(ctx context.Context, dlg mtp.Entity, offsetID int, before time.Time, do func(ctx context.Context, request func() error) error) iter.Seq2[messages.Elem, error] {
+	return func(yield func(messages.Elem, error) bool) {
+		q := c.Query(dlg).FromID(&tg.InputPeerSelf{}).Filter(&tg.InputMessagesFilterEmpty{})
+		if !before.IsZero() {
+			q = q.MaxDate(int(before.Unix()))
+		}
+		page := messages.QueryFunc(func(ctx context.Context, req messages.Request) (resp tg.MessagesMessagesClass, err error) {
+			err = do(ctx, func() (err error) {
+				resp, err = q.Query(ctx, req)
+				return err
+			})
+			return resp, err
+		})
+		it := messages.NewIterator(page, scanBatch).OffsetID(offsetID)
+		for it.Next(ctx) {
+			if !yield(it.Value(), nil) {
+				return
+			}
+		}
+		if err := it.Err(); err != nil {
+			yield(messages.Elem{}, err)
+		}
+	}
+}
+
+// DialogFilters returns the chat folders of the user.
+func (c *Client) DialogFilters(ctx context.Context) ([]tg.DialogFilterClass, error) {
+	resp, err := c.API().MessagesGetDialogFilters(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return resp.Filters, nil
+}
+
+// ResolveUsername resolves the public username of the chat or channel.  It
+// works for the chats that the user is not a member of.
+func (c *Client) ResolveUsername(ctx context.Context, username string) (mtp.Entity, error) {
+	resp, err := c.API().ContactsResolveUsername(ctx, &tg.ContactsResolveUsernameRequest{Username: username})
+	if err != nil {
+		return nil, err
+	}
+	switch p := resp.Peer.(type) {
+	case *tg.PeerChannel:
+		for _, ch := range resp.Chats {
+			if ch, ok := ch.(*tg.Channel); ok && ch.ID == p.ChannelID {
+				return ch, nil
+			}
+		}
+	case *tg.PeerChat:
+		for _, ch := range resp.Chats {
+			if ch, ok := ch.(*tg.Chat); ok && ch.ID == p.ChatID {
+				return ch, nil
+			}
+		}
+	case *tg.PeerUser:
+		return nil, fmt.Errorf("@%s is a user, not a chat", username)
+	}
+	return nil, fmt.Errorf("@%s: chat not found", username)
+}
+
+// archiveFolderID is the ID of the archive folder.
+const archiveFolderID = 1
+
+// ArchivedChats returns the IDs of the archived chats and channels.
+func (c *Client) ArchivedChats(ctx context.Context) ([]int64, error) {
+	elems, err := dialogs.NewQueryBuilder(c.API()).GetDialogs().FolderID(archiveFolderID).BatchSize(100).Collect(ctx)
+	if err != nil {
+		return nil, err
+	}
+	var ids []int64
+	for _, e := range elems {
+		switch p := e.Peer.(type) {
+		case *tg.InputPeerChat:
+			ids = append(ids, p.ChatID)
+		case *tg.InputPeerChannel:
+			ids = append(ids, p.ChannelID)
+		}
+	}
+	return ids, nil
+}
+
+// inputPeer returns the input peer of the chat.  Unlike mtp.AsInputPeer, it
+// supports the private chats, and returns an error for the unsupported
+// types, instead of panicking.
+func inputPeer(chat mtp.Entity) (tg.InputPeerClass, error) {
+	switch e := chat.(type) {
+	case User:
+		return e.AsInputPeer(), nil
+	case *tg.Chat:
+		return e.AsInputPeer(), nil
+	case *tg.Channel:
+		return e.AsInputPeer(), nil
+	}
+	return nil, fmt.Errorf("unsupported chat type: %T", chat)
+}
+
+// CountMyMessages returns the number of messages of the current user in the
+// chat.  It makes a search with the zero limit, and takes the count from the
+// response, so that the messages are not fetched.  If the server returns the
+// complete list instead of the count, the count is the length of the list.
+func (c *Client) CountMyMessages(ctx context.Context, chat mtp.Entity) (int, error) {
+	peer, err := inputPeer(chat)
+	if err != nil {
+		return 0, err
+	}
+	resp, err := c.API().MessagesSearch(ctx, &tg.MessagesSearchRequest{
+		Peer:   peer,
+		FromID: &tg.InputPeerSelf{},
+		Filter: &tg.InputMessagesFilterEmpty{},
+		Limit:  0,
+	})
+	if err != nil {
+		return 0, err
+	}
+	return messagesCount(resp)
+}
+
+// messagesCount returns the total number of messages from the search
+// response.
+func messagesCount(resp tg.MessagesMessagesClass) (int, error) {
+	switch r := resp.(type) {
+	case *tg.MessagesMessages:
+		// the complete list, it has no count.
+		return len(r.Messages), nil
+	case *tg.MessagesMessagesSlice:
+		return r.Count, nil
+	case *tg.MessagesChannelMessages:
+		return r.Count, nil
+	}
+	return 0, fmt.Errorf("unexpected response type: %T", resp)
+}
@@ -3,6 +3,7 @@ package tui
 import (
 	"context"
 	"fmt"
+	"time"
 
 	"github.com/gdamore/tcell/v2"
 	"github.com/looplab/fsm"
@@ -21,10 +22,14 @@ const (
 )
 
 type App struct {
-	tva *tview.Application
-	tg  waipu.Telegramer
-	log *dlog.Logger
-	fsm *fsm.FSM
+	tva   *tview.Application
+	tg    waipu.Telegramer
+	wiper *waipu.Wiper
+	log   *dlog.Logger
+	fsm   *fsm.FSM
+	// count is the number of the concurrent requests counting the messages
+	// in the chat list, zero disables counting.
+	count int
 
 	pages *tview.Pages
 	view  views
@@ -35,15 +40,20 @@ type views struct {
 	mbConfirm *tview.Modal
 	mbNothing *tview.Modal
 	fmSearch  *tview.Form
+	fmFilter  *tview.Form
+	fmMatch   *tview.Form
 
 	lvChats *tview.List
 	tvLog   *tview.TextView
 }
 
-func New(ctx context.Context, tg waipu.Telegramer) *App {
+// New creates a new text UI application.  opts are passed to the Wiper that
+// scans and deletes the messages.
+func New(ctx context.Context, tg waipu.Telegramer, opts ...waipu.Option) *App {
 	app := &App{
-		tva: tview.NewApplication(),
-		tg:  tg,
+		tva:   tview.NewApplication(),
+		tg:    tg,
+		wiper: waipu.NewWiper(tg, opts...),
 
 		pages: tview.NewPages(),
 		view: views{
@@ -51,6 +61,8 @@ func New(ctx context.Context, tg waipu.Telegramer) *App {
 			mbConfirm: tview.NewModal(),
 			mbNothing: tview.NewModal(),
 			fmSearch:  tview.NewForm(),
+			fmFilter:  tview.NewForm(),
+			fmMatch:   tview.NewForm(),
 
 			lvChats: tview.NewList(),
 			tvLog:   tview.NewTextView(),
@@ -59,6 +71,8 @@ func New(ctx context.Context, tg waipu.Telegramer) *App {
 
 	app.initMain(ctx)
 	app.initFind(ctx)
+	app.initFilter(ctx)
+	app.initMatch(ctx)
 	app.initConfirm(ctx)
 	app.initNothing(ctx)
 
@@ -72,8 +86,18 @@ func New(ctx context.Context, tg waipu.Telegramer) *App {
 	return app
 }
 
+// CountMessages enables counting the user messages in each chat of the chat
+// list, with at most n concurrent requests.  It has no effect, if the
+// Telegram client does not implement waipu.MessageCounter.
+func (app *App) CountMessages(n int) {
+	app.count = n
+}
+
 func (app *App) Run(ctx context.Context, chats []mtp.Entity) error {
 	app.populateChatList(ctx, chats)
+	if mc, ok := app.tg.(waipu.MessageCounter); ok && app.count > 0 {
+		go app.countMessages(ctx, mc, chats)
+	}
 
 	if err := app.tva.SetRoot(app.pages, true).EnableMouse(false).Run(); err != nil {
 		return err
@@ -97,6 +121,9 @@ func (app *App) handleKeystrokes(event *tcell.EventKey) *tcell.EventKey {
 
 	switch event.Key() {
 	case tcell.KeyCtrlQ, tcell.KeyF10:
+		if app.fsm.Current() == stConfirming {
+			app.discard()
+		}
 		app.tva.Stop()
 	default:
 		return event
@@ -122,6 +149,25 @@ func (app *App) printf(format string, a ...any) {
 	_, _ = fmt.Fprintf(app.view.tvLog, format, a...)
 }
 
+// waitFunc returns the function that counts down the flood wait in the log.
+func (app *App) waitFunc() waipu.WaitFunc {
+	waiting := false
+	return func(left time.Duration) {
+		switch {
+		case left == 0:
+			if waiting {
+				app.printf("...resuming\n")
+			}
+			waiting = false
+		case !waiting:
+			waiting = true
+			app.logf("Rate limited by Telegram, waiting %s", left)
+		case left%(10*time.Second) == 0:
+			app.printf("...%s", left)
+		}
+	}
+}
+
 // modal wraps a primitive in a modal box.
 func modal(p tview.Primitive, width int, height int) tview.Primitive {
 	return tview.NewGrid().
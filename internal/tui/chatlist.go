@@ -7,11 +7,17 @@ import (
 	"github.com/gdamore/tcell/v2"
 	"github.com/rivo/tview"
 
+	"github.com/rusq/dlog"
+
 	mtp "github.com/rusq/mtpwrap"
+	"github.com/rusq/wipemychat/internal/waipu"
 )
 
 const infoText = "Press <Ctrl+Q> or <F10> to quit, <Ctrl+F> or </> to search chats"
 
+// lockMarker marks the protected chats in the chat list.
+const lockMarker = "🔒 "
+
 func (app *App) initMain(context.Context) {
 	app.view.lvChats.
 		SetHighlightFullLine(true).
@@ -55,22 +61,56 @@ func (app *App) initMain(context.Context) {
 func (app *App) populateChatList(ctx context.Context, chats []mtp.Entity) {
 	for _, chat := range chats {
 		app.view.lvChats.AddItem(
-			chat.GetTitle(),
-			fmt.Sprintf("  %s (%d)", chat.TypeInfo().Name, chat.GetID()),
+			app.chatTitle(chat),
+			chatInfo(chat),
 			0,
 			func() { app.handleChats(ctx, chats) },
 		)
 	}
 }
 
+// chatTitle returns the main text of the chat list item: the chat title,
+// with the lock marker, if the chat is protected.
+func (app *App) chatTitle(chat mtp.Entity) string {
+	if app.wiper.IsProtected(chat) {
+		return lockMarker + chat.GetTitle()
+	}
+	return chat.GetTitle()
+}
+
+// chatInfo returns the secondary text of the chat list item.
+func chatInfo(chat mtp.Entity) string {
+	return fmt.Sprintf("  %s (%d)", chat.TypeInfo().Name, chat.GetID())
+}
+
+// countMessages counts the user messages in the chats, and adds the counts
+// to the chat list items as they arrive.
+func (app *App) countMessages(ctx context.Context, cl waipu.MessageCounter, chats []mtp.Entity) {
+	waipu.CountMessages(ctx, cl, chats, app.count, func(i int, count int, err error) {
+		if err != nil {
+			dlog.Debugf("chat %d: failed to count the messages: %s", chats[i].GetID(), err)
+			return
+		}
+		app.tva.QueueUpdateDraw(func() {
+			app.view.lvChats.SetItemText(i, app.chatTitle(chats[i]), fmt.Sprintf("%s, %d messages", chatInfo(chats[i]), count))
+		})
+	})
+}
+
+// handleChats handles the chat selection.  It remembers the selected chat and
+// shows the filter form, the scan is started once the text filter is
+// confirmed.
+// Protected chats can not be selected.
 func (app *App) handleChats(ctx context.Context, chats []mtp.Entity) {
+	selected := chats[app.view.lvChats.GetCurrentItem()]
+	if app.wiper.IsProtected(selected) {
+		app.logf("Chat %q is protected, use -unprotect to allow wiping it", selected.GetTitle())
+		return
+	}
 	if !app.event(ctx, evSelected) {
 		return
 	}
-
-	selected := chats[app.view.lvChats.GetCurrentItem()]
-	// async fetch is needed so that the tvLog will keep updating.
-	go app.runDelete(ctx, selected)
+	app.fsm.SetMetadata(metaChat, selected)
 }
 
 func (app *App) runDelete(ctx context.Context, selected mtp.Entity) {
@@ -82,9 +122,12 @@ func (app *App) runDelete(ctx context.Context, selected mtp.Entity) {
 	}()
 	app.view.tvLog.Clear()
 
-	app.logf("Scanning chat: %s, please wait...", selected.GetTitle())
+	app.logf("Scanning chat: %s (%s), please wait...", selected.GetTitle(), app.wiper.Filter())
+	if r := app.wiper.Retention(); !r.IsEmpty() {
+		app.logf("Retention: %s", r)
+	}
 	total := 0
-	msgs, err := app.tg.SearchAllMyMessages(context.Background(), selected, func(n int) {
+	msgs, err := app.wiper.Scan(waipu.NotifyWait(context.Background(), app.waitFunc()), selected, func(n int) {
 		total += n
 		if total > 0 && total%100 == 0 {
 			app.printf("...%d", total)
@@ -110,8 +153,12 @@ func (app *App) runDelete(ctx context.Context, selected mtp.Entity) {
 
 	app.fsm.SetMetadata(metaChat, selected)
 	app.fsm.SetMetadata(metaMessages, msgs)
-	app.view.mbConfirm.SetText(fmt.Sprintf("Found %d messages in %q.  Delete?", len(msgs), selected.GetTitle()))
 
+	text := fmt.Sprintf("Found %d messages in %q.  Delete?", len(msgs), selected.GetTitle())
+	if app.wiper.Exports() {
+		text += "\n\nMessages will be exported before deletion."
+	}
+	app.view.mbConfirm.SetText(text)
 	if !app.event(ctx, evFetched) {
 		app.cancel(ctx)
 		return
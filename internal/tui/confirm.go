@@ -8,6 +8,7 @@ import (
 	"github.com/gotd/td/telegram/query/messages"
 
 	mtp "github.com/rusq/mtpwrap"
+	"github.com/rusq/wipemychat/internal/waipu"
 )
 
 func (app *App) initConfirm(ctx context.Context) {
@@ -57,7 +58,7 @@ func (app *App) handleDelete(ctx context.Context) error {
 		return fmt.Errorf("messages missing: %s", err)
 	}
 	app.logf("Deleting %d messages from %s, please wait . . .", len(msgs), chat.GetTitle())
-	n, err := app.tg.DeleteMessages(context.Background(), chat, msgs)
+	n, err := app.wiper.Delete(waipu.NotifyWait(context.Background(), app.waitFunc()), chat, msgs)
 	if err != nil {
 		return err
 	}
@@ -65,3 +66,15 @@ func (app *App) handleDelete(ctx context.Context) error {
 
 	return nil
 }
+
+// discard drops the progress of the scanned chat, so that the messages are
+// not deleted by the later -resume without the confirmation.
+func (app *App) discard() {
+	chat, err := metadata[mtp.Entity](app.fsm, metaChat)
+	if err != nil {
+		return
+	}
+	if err := app.wiper.Discard(chat); err != nil {
+		app.error(err)
+	}
+}
@@ -0,0 +1,89 @@
+package tui
+
+import (
+	"context"
+	"time"
+
+	"github.com/gdamore/tcell/v2"
+	"github.com/rivo/tview"
+
+	"github.com/rusq/wipemychat/internal/waipu"
+)
+
+const (
+	lblAfter  = "After"
+	lblBefore = "Before"
+
+	btnScan   = "Scan"
+	btnCancel = "Cancel"
+)
+
+func (app *App) initFilter(ctx context.Context) {
+	app.pages.AddPage(stFiltering, modal(app.view.fmFilter, 50, 8+len(waipu.FilterKinds)), true, false)
+	f := app.wiper.Filter()
+	app.view.fmFilter.
+		AddInputField(lblAfter, fmtDate(f.After), 20, nil, nil).
+		AddInputField(lblBefore, fmtDate(f.Before), 20, nil, nil)
+	// message types, none checked means all types.
+	for _, k := range waipu.FilterKinds {
+		app.view.fmFilter.AddCheckbox(string(k), f.HasKind(k), nil)
+	}
+	app.view.fmFilter.
+		AddButton(btnScan, func() { app.handleFilter(ctx) }).
+		AddButton(btnCancel, func() { app.cancel(ctx) }).
+		SetCancelFunc(func() { app.cancel(ctx) }).
+		SetItemPadding(0).
+		SetBorder(true).
+		SetTitle("[ Filter: dates (YYYY-MM-DD) and types, empty for all ]").
+		SetBackgroundColor(tcell.ColorDarkCyan)
+}
+
+// handleFilter sets the dates and types of the filter from the form, and
+// shows the text filter form.
+func (app *App) handleFilter(ctx context.Context) {
+	after, err := waipu.ParseDate(app.formText(lblAfter))
+	if err != nil {
+		app.error(err)
+		return
+	}
+	before, err := waipu.ParseDate(app.formText(lblBefore))
+	if err != nil {
+		app.error(err)
+		return
+	}
+	// the text filter is set in the next step, see handleMatch.
+	filter := app.wiper.Filter()
+	filter.After, filter.Before, filter.Kinds = after, before, app.checkedKinds()
+	if err := filter.Validate(); err != nil {
+		app.error(err)
+		return
+	}
+	app.wiper.SetFilter(filter)
+	app.event(ctx, evFiltered)
+}
+
+// formText returns the text of the filter form input field with the label.
+func (app *App) formText(label string) string {
+	return app.view.fmFilter.GetFormItemByLabel(label).(*tview.InputField).GetText()
+}
+
+// checkedKinds returns the message types checked in the filter form.
+func (app *App) checkedKinds() []waipu.Kind {
+	var kinds []waipu.Kind
+	for _, k := range waipu.FilterKinds {
+		if app.view.fmFilter.GetFormItemByLabel(string(k)).(*tview.Checkbox).IsChecked() {
+			kinds = append(kinds, k)
+		}
+	}
+	return kinds
+}
+
+func fmtDate(t time.Time) string {
+	if t.IsZero() {
+		return ""
+	}
+	if t.Hour() == 0 && t.Minute() == 0 && t.Second() == 0 {
+		return t.Format(time.DateOnly)
+	}
+	return t.Format("2006-01-02T15:04:05")
+}
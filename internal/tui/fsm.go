@@ -17,10 +17,12 @@ type machine struct {
 const (
 	// events
 	evSelected    = "selected"
+	evFiltered    = "filtered"
 	evCancelled   = "cancelled"
 	evConfirmed   = "confirmed"
 	evDeleted     = "deleted"
 	evFetched     = "fetched"
+	evMatched     = "matched"
 	evNothingToDo = "nothing_to_do"
 	evSearch      = "search"
 	evLocate      = "locate"
@@ -28,7 +30,9 @@ const (
 	// states
 	stSelecting  = "selecting"
 	stSearching  = "searching"
+	stFiltering  = "filtering"
 	stFetching   = "fetching"
+	stMatching   = "matching"
 	stConfirming = "confirming"
 	stDeleting   = "deleting"
 	stNothing    = "nothing"
@@ -43,7 +47,9 @@ func initFSM(app *App) *fsm.FSM {
 	sm := fsm.NewFSM(
 		stSelecting,
 		fsm.Events{
-			{Name: evSelected, Src: []string{stSelecting}, Dst: stFetching},
+			{Name: evSelected, Src: []string{stSelecting}, Dst: stFiltering},
+			{Name: evFiltered, Src: []string{stFiltering}, Dst: stMatching},
+			{Name: evMatched, Src: []string{stMatching}, Dst: stFetching},
 			{Name: evFetched, Src: []string{stFetching}, Dst: stConfirming},
 			{Name: evNothingToDo, Src: []string{stFetching}, Dst: stNothing},
 			{Name: evConfirmed, Src: []string{stConfirming}, Dst: stDeleting},
@@ -52,7 +58,7 @@ func initFSM(app *App) *fsm.FSM {
 			{Name: evSearch, Src: []string{stSelecting}, Dst: stSearching},
 			{Name: evLocate, Src: []string{stSearching}, Dst: stSelecting},
 			// cancel
-			{Name: evCancelled, Src: []string{stFetching, stConfirming, stNothing, stSearching}, Dst: stSelecting},
+			{Name: evCancelled, Src: []string{stFiltering, stFetching, stMatching, stConfirming, stNothing, stSearching}, Dst: stSelecting},
 		},
 		fsm.Callbacks{
 			m.enter("state"): func(_ context.Context, e *fsm.Event) {
@@ -63,6 +69,8 @@ func initFSM(app *App) *fsm.FSM {
 			m.leave(stConfirming): m.hidePage,
 			m.leave(stNothing):    m.hidePage,
 			m.leave(stSearching):  m.hidePage,
+			m.leave(stFiltering):  m.hidePage,
+			m.leave(stMatching):   m.hidePage,
 			m.leave(stDeleting):   m.leaveDeleting,
 			// events
 			m.after(evCancelled): m.afterCancelled,
@@ -102,7 +110,11 @@ func (m *machine) leaveDeleting(ctx context.Context, e *fsm.Event) {
 // Events
 //
 
-func (m *machine) afterCancelled(context.Context, *fsm.Event) {
+func (m *machine) afterCancelled(_ context.Context, e *fsm.Event) {
+	if e.Src == stConfirming {
+		// the chat was scanned, but the deletion was not confirmed.
+		m.app.discard()
+	}
 	// clear metadata
 	m.cleanUp()
 	m.app.logf("Operation cancelled")
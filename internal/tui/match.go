@@ -0,0 +1,64 @@
+package tui
+
+import (
+	"context"
+
+	"github.com/gdamore/tcell/v2"
+	"github.com/rivo/tview"
+
+	mtp "github.com/rusq/mtpwrap"
+	"github.com/rusq/wipemychat/internal/waipu"
+)
+
+const (
+	lblMatch   = "Match"
+	lblExclude = "Exclude"
+)
+
+// initMatch initialises the content filter form, that is shown after the
+// dates and types are set, before the chat is scanned.
+func (app *App) initMatch(ctx context.Context) {
+	app.pages.AddPage(stMatching, modal(app.view.fmMatch, 60, 9), true, false)
+	f := app.wiper.Filter()
+	app.view.fmMatch.
+		AddInputField(lblMatch, f.Content.String(), 40, nil, nil).
+		AddInputField(lblExclude, f.ExcludeContent.String(), 40, nil, nil).
+		AddButton(btnScan, func() { app.handleMatch(ctx) }).
+		AddButton(btnCancel, func() { app.cancel(ctx) }).
+		SetCancelFunc(func() { app.cancel(ctx) }).
+		SetBorder(true).
+		SetTitle("[ Text filter: text, kw:WORD1,WORD2 or re:EXPR ]").
+		SetBackgroundColor(tcell.ColorDarkCyan)
+}
+
+// handleMatch sets the content filter from the form, and starts the scan of
+// the selected chat.  The complete filter is applied by the wiper before
+// the retention, the same way as in the batch mode.
+func (app *App) handleMatch(ctx context.Context) {
+	form := app.view.fmMatch
+	content, err := waipu.ParseMatcher(form.GetFormItemByLabel(lblMatch).(*tview.InputField).GetText())
+	if err != nil {
+		app.error(err)
+		return
+	}
+	exclude, err := waipu.ParseMatcher(form.GetFormItemByLabel(lblExclude).(*tview.InputField).GetText())
+	if err != nil {
+		app.error(err)
+		return
+	}
+
+	selected, err := metadata[mtp.Entity](app.fsm, metaChat)
+	if err != nil {
+		app.error(err)
+		app.cancel(ctx)
+		return
+	}
+	filter := app.wiper.Filter()
+	filter.Content, filter.ExcludeContent = content, exclude
+	app.wiper.SetFilter(filter)
+	if !app.event(ctx, evMatched) {
+		return
+	}
+	// async fetch is needed so that the tvLog will keep updating.
+	go app.runDelete(ctx, selected)
+}
@@ -0,0 +1,156 @@
+package waipu
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/gotd/td/tg"
+	"github.com/rusq/dlog"
+	mtp "github.com/rusq/mtpwrap"
+)
+
+const month = 31 * day
+
+// AutoDeleter gets and sets the Telegram auto-delete timer of the chats.
+type AutoDeleter interface {
+	// GetDialogs returns the private chats, chats and channels.
+	GetDialogs(ctx context.Context) ([]mtp.Entity, error)
+	HistoryTTL(ctx context.Context, chat mtp.Entity) (time.Duration, error)
+	SetHistoryTTL(ctx context.Context, chat mtp.Entity, period time.Duration) error
+}
+
+// ParseAutoDelete parses the auto-delete period: "off" turns the timer off,
+// "1d", "1w" and "1m" (one month) are the periods offered by the Telegram
+// apps, and any age from 1 day to 1 year is accepted.
+func ParseAutoDelete(s string) (time.Duration, error) {
+	switch strings.ToLower(strings.TrimSpace(s)) {
+	case "off", "0":
+		return 0, nil
+	case "1m", "month":
+		return month, nil
+	}
+	d, err := ParseAge(s)
+	if err != nil {
+		return 0, err
+	}
+	if d < day || d > 365*day {
+		return 0, fmt.Errorf("invalid auto-delete period: %q, must be from 1d to 365d", s)
+	}
+	return d.Round(time.Second), nil
+}
+
+// fmtPeriod formats the auto-delete period.
+func fmtPeriod(d time.Duration) string {
+	if d == 0 {
+		return "off"
+	}
+	return fmtAge(d)
+}
+
+// autoDeleteChats returns the chats selected by sel, sorted by title.  The
+// folder terms and the usernames of the chats that are not in the list are
+// resolved as by ResolveTargets, if cl supports it, the chats that are not
+// found are logged.
+func autoDeleteChats(ctx context.Context, cl AutoDeleter, sel Selector) ([]mtp.Entity, error) {
+	chats, err := cl.GetDialogs(ctx)
+	if err != nil {
+		return nil, err
+	}
+	t, err := resolveTargets(ctx, cl, chats, sel)
+	if err != nil {
+		return nil, err
+	}
+	for _, spec := range t.Missing {
+		dlog.Printf("%s: chat not found", spec)
+	}
+	sortByTitle(t.Chats)
+	return t.Chats, nil
+}
+
+// ShowAutoDelete writes the auto-delete period of the chats selected by sel
+// to w.
+func ShowAutoDelete(ctx context.Context, w io.Writer, cl AutoDeleter, sel Selector) error {
+	chats, err := autoDeleteChats(ctx, cl, sel)
+	if err != nil {
+		return err
+	}
+	tw := tabwriter.NewWriter(w, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(tw, "ID\tTYPE\tTITLE\tAUTO-DELETE")
+	for _, chat := range chats {
+		period := "unknown"
+		if ttl, err := cl.HistoryTTL(ctx, chat); err != nil {
+			dlog.Printf("chat %d: %s", chat.GetID(), err)
+		} else {
+			period = fmtPeriod(ttl)
+		}
+		fmt.Fprintf(tw, "%d\t%s\t%s\t%s\n", chat.GetID(), ChatType(chat), chat.GetTitle(), period)
+	}
+	return tw.Flush()
+}
+
+// SetAutoDelete sets the auto-delete period of the chats selected by sel,
+// zero period turns the auto-delete off.  The result for each chat is
+// written to w.  Chats where the period can not be set are reported, and do
+// not stop the operation.  The timer is not turned on in the protected
+// chats.
+func SetAutoDelete(ctx context.Context, w io.Writer, cl AutoDeleter, sel Selector, period time.Duration, protected *Protected) error {
+	chats, err := autoDeleteChats(ctx, cl, sel)
+	if err != nil {
+		return err
+	}
+	tw := tabwriter.NewWriter(w, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(tw, "ID\tTYPE\tTITLE\tWAS\tRESULT")
+	for _, chat := range chats {
+		if err := ctx.Err(); err != nil {
+			tw.Flush()
+			return err
+		}
+		was, result := "unknown", ""
+		if period > 0 && protected.Contains(chat.GetID()) {
+			result = "protected"
+		} else if !canSetTTL(chat) {
+			result = "not allowed"
+		} else if ttl, err := cl.HistoryTTL(ctx, chat); err != nil {
+			result = "error: " + err.Error()
+		} else if was = fmtPeriod(ttl); ttl == period {
+			result = "unchanged"
+		} else if err := cl.SetHistoryTTL(ctx, chat, period); err != nil {
+			result = "error: " + err.Error()
+		} else {
+			result = "set to " + fmtPeriod(period)
+		}
+		fmt.Fprintf(tw, "%d\t%s\t%s\t%s\t%s\n", chat.GetID(), ChatType(chat), chat.GetTitle(), was, result)
+	}
+	return tw.Flush()
+}
+
+// canSetTTL returns false, if the auto-delete timer of the chat can not be
+// set for sure: the chat was left, or it is the channel where the user is
+// not an administrator.
+func canSetTTL(chat mtp.Entity) bool {
+	switch c := chat.(type) {
+	case *tg.Chat:
+		return !c.Left && !c.Deactivated
+	case *tg.Channel:
+		if c.Left {
+			return false
+		}
+		if c.Broadcast {
+			_, admin := c.GetAdminRights()
+			return c.Creator || admin
+		}
+	}
+	return true
+}
+
+// sortByTitle sorts the chats by title.
+func sortByTitle(chats []mtp.Entity) {
+	sort.Slice(chats, func(i, j int) bool {
+		return chats[i].GetTitle() < chats[j].GetTitle()
+	})
+}
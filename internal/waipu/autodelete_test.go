@@ -0,0 +1,136 @@
+package waipu
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gotd/td/tg"
+	mtp "github.com/rusq/mtpwrap"
+)
+
+// fakeAutoDeleter keeps the auto-delete periods in memory.
+type fakeAutoDeleter struct {
+	chats []mtp.Entity
+	ttl   map[int64]time.Duration
+}
+
+func (f *fakeAutoDeleter) GetDialogs(context.Context) ([]mtp.Entity, error) {
+	return f.chats, nil
+}
+
+func (f *fakeAutoDeleter) HistoryTTL(_ context.Context, chat mtp.Entity) (time.Duration, error) {
+	return f.ttl[chat.GetID()], nil
+}
+
+func (f *fakeAutoDeleter) SetHistoryTTL(_ context.Context, chat mtp.Entity, period time.Duration) error {
+	f.ttl[chat.GetID()] = period
+	return nil
+}
+
+func TestSetAutoDelete(t *testing.T) {
+	f := &fakeAutoDeleter{
+		chats: []mtp.Entity{
+			&tg.Chat{ID: 1, Title: "group"},
+			&tg.Chat{ID: 2, Title: "weekly"},
+			&tg.Channel{ID: 3, Title: "news", Broadcast: true},
+			&tg.Chat{ID: 4, Title: "left", Left: true},
+			&tg.Chat{ID: 5, Title: "family"},
+		},
+		ttl: map[int64]time.Duration{2: week},
+	}
+	sel, err := ParseSelector("type:group", "type:channel")
+	if err != nil {
+		t.Fatal(err)
+	}
+	protected := newProtected(t, &tg.Chat{ID: 5, Title: "family"})
+	var buf bytes.Buffer
+	if err := SetAutoDelete(context.Background(), &buf, f, sel, week, protected); err != nil {
+		t.Fatalf("SetAutoDelete() error = %v", err)
+	}
+	if f.ttl[1] != week {
+		t.Errorf("chat 1 period = %s, want %s", f.ttl[1], week)
+	}
+	if _, ok := f.ttl[3]; ok {
+		t.Error("period was set in the channel where the user is not an admin")
+	}
+	if _, ok := f.ttl[4]; ok {
+		t.Error("period was set in the chat that was left")
+	}
+	if _, ok := f.ttl[5]; ok {
+		t.Error("period was set in the protected chat")
+	}
+	for _, want := range []string{"set to 7d", "unchanged", "not allowed", "protected"} {
+		if !strings.Contains(buf.String(), want) {
+			t.Errorf("output does not contain %q:\n%s", want, buf.String())
+		}
+	}
+}
+
+func TestParseAutoDelete(t *testing.T) {
+	tests := []struct {
+		s       string
+		want    time.Duration
+		wantErr bool
+	}{
+		{"off", 0, false},
+		{"1d", day, false},
+		{"1w", week, false},
+		{"1m", month, false},
+		{"90d", 90 * day, false},
+		{"12h", 0, true},
+		{"2y", 0, true},
+		{"400d", 0, true},
+	}
+	for _, tt := range tests {
+		got, err := ParseAutoDelete(tt.s)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("ParseAutoDelete(%q) error = %v, wantErr %v", tt.s, err, tt.wantErr)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("ParseAutoDelete(%q) = %s, want %s", tt.s, got, tt.want)
+		}
+	}
+}
+
+// fakeFolderAutoDeleter is the fakeAutoDeleter with the chat folders.
+type fakeFolderAutoDeleter struct {
+	*fakeAutoDeleter
+	filters []tg.DialogFilterClass
+}
+
+func (f fakeFolderAutoDeleter) DialogFilters(context.Context) ([]tg.DialogFilterClass, error) {
+	return f.filters, nil
+}
+
+func (f fakeFolderAutoDeleter) ResolveUsername(context.Context, string) (mtp.Entity, error) {
+	return nil, errors.New("USERNAME_NOT_OCCUPIED")
+}
+
+func TestShowAutoDelete_folder(t *testing.T) {
+	f := fakeFolderAutoDeleter{
+		fakeAutoDeleter: &fakeAutoDeleter{
+			chats: []mtp.Entity{&tg.Chat{ID: 1, Title: "work"}, &tg.Chat{ID: 2, Title: "family"}},
+			ttl:   map[int64]time.Duration{1: week},
+		},
+		filters: []tg.DialogFilterClass{
+			&tg.DialogFilter{Title: tg.TextWithEntities{Text: "Work"}, IncludePeers: []tg.InputPeerClass{&tg.InputPeerChat{ChatID: 1}}},
+		},
+	}
+	sel, err := ParseSelector("folder:Work", "@missing")
+	if err != nil {
+		t.Fatal(err)
+	}
+	l, _ := OpenLimiter("")
+	var buf bytes.Buffer
+	if err := ShowAutoDelete(context.Background(), &buf, l.WrapAutoDeleter(f), sel); err != nil {
+		t.Fatalf("ShowAutoDelete() error = %v", err)
+	}
+	if out := buf.String(); !strings.Contains(out, "work") || strings.Contains(out, "family") {
+		t.Errorf("unexpected chats:\n%s", out)
+	}
+}
@@ -4,46 +4,136 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"time"
 
 	"github.com/rusq/dlog"
 	mtp "github.com/rusq/mtpwrap"
 	"github.com/schollz/progressbar/v3"
 )
 
-func Batch(ctx context.Context, cl Telegramer, ids []int64) error {
-	chats, err := cl.GetChats(ctx)
-	if err != nil {
-		return err
+// Batch wipes the target chats, see ResolveTargets.  The missing chats are
+// reported and skipped.  If the run limits are reached, see WithLimits, the
+// rest of the chats are reported as stopped.  The result of each chat is
+// added to the report, if it is set with WithReport, and the returned error
+// is the error of the report, see Report.Err.
+func Batch(ctx context.Context, cl Telegramer, targets Targets, opts ...Option) error {
+	w := NewWiper(cl, opts...)
+	if f := w.Filter(); !f.IsEmpty() {
+		dlog.Printf("filter: %s", f)
 	}
-	for _, id := range ids {
-		if n, err := wipe(ctx, cl, chats, id); err != nil {
-			dlog.Printf("SKIPPED: chat %d: error deleting messages %s", id, err)
-		} else {
-			dlog.Printf("OK: chat: %d: messages deleted: %d", id, n)
-		}
+	if r := w.Retention(); !r.IsEmpty() {
+		dlog.Printf("retention: %s", r)
 	}
-	return nil
-}
+	b := w.startBudget()
+	if b != nil {
+		dlog.Printf("run limits: %s", b.limits)
+	}
+	if w.opts.plan != nil {
+		w.opts.plan.Filter = w.Filter().String()
+	}
+	rep := w.opts.report
+	if rep == nil {
+		rep = new(Report)
+	}
+	rep.Started = time.Now()
+	defer rep.finish()
 
-func wipe(ctx context.Context, cl Telegramer, chats []mtp.Entity, id int64) (int, error) {
-	idx, err := findIdxOf(chats, id)
-	if err != nil {
-		return 0, err
+	for _, spec := range targets.Missing {
+		dlog.Printf("SKIPPED: chat %s: chat not found", spec)
 	}
+	rep.notFound("", targets.Missing)
+	var stopped stoppedChats
+	for i, chat := range targets.Chats {
+		if ctx.Err() != nil {
+			dlog.Printf("INTERRUPTED: %d chats were not processed", len(targets.Chats)-i)
+			for _, res := range interrupted("", targets.Chats[i:]) {
+				rep.add(res)
+			}
+			break
+		}
+		if err := b.check(); err != nil {
+			stopped.add(chat, ChatResult{}, err)
+			continue
+		}
+		res := wipeChat(ctx, w, chat)
+		if res.Status == StatusStopped {
+			stopped.add(chat, res, nil)
+			continue
+		}
+		rep.add(res)
+		switch res.Status {
+		case StatusProtected:
+			dlog.Printf("SKIPPED: chat %d: chat is protected", res.ID)
+		case StatusFailed, StatusInterrupted:
+			dlog.Printf("SKIPPED: chat %d: error deleting messages %s", res.ID, res.Error)
+		case StatusDryRun:
+			dlog.Printf("DRY RUN: chat: %d: messages to delete: %d", res.ID, res.Found)
+		case StatusPlanned:
+			dlog.Printf("PLANNED: chat: %d: messages to delete: %d", res.ID, res.Found)
+		default:
+			dlog.Printf("OK: chat: %d: messages deleted: %d", res.ID, res.Deleted)
+		}
+	}
+	stopped.finish(ctx, cl, "", rep)
+	return rep.Err()
+}
 
+// wipeEntity wipes the chat, see Wiper.Wipe, or, depending on the wiper
+// options, reports or plans the messages.  It returns the number of messages
+// found and deleted.
+func wipeEntity(ctx context.Context, w *Wiper, chat mtp.Entity) (found int, deleted int, err error) {
 	pb := progressbar.New(-1)
-	pb.Describe(fmt.Sprintf("scanning %d (%s)", id, chats[idx].GetTitle()))
+	action := "scanning"
+	if w.opts.deletes() {
+		action = "wiping"
+	}
+	desc := fmt.Sprintf("%s %d (%s)", action, chat.GetID(), chat.GetTitle())
+	ctx = NotifyWait(ctx, func(left time.Duration) {
+		if left > 0 {
+			pb.Describe(fmt.Sprintf("%s: rate limited, %s left", desc, left))
+		} else {
+			pb.Describe(desc)
+		}
+	})
+	pb.Describe(desc)
 	pb.RenderBlank()
-	messages, err := cl.SearchAllMyMessages(ctx, chats[idx], func(n int) {
-		pb.Add(1)
+	if w.opts.deletes() {
+		// the messages are deleted while the scan goes on.
+		found, deleted, err = w.Wipe(ctx, chat, func(n int) {
+			pb.Add(n)
+		})
+		pb.Finish()
+		fmt.Print("\r")
+		return found, deleted, err
+	}
+	messages, err := w.Scan(ctx, chat, func(n int) {
+		pb.Add(n)
 	})
 	pb.Finish()
 	fmt.Print("\r")
 	if err != nil {
-		return 0, err
+		return 0, 0, err
 	}
-
-	return cl.DeleteMessages(ctx, chats[idx], messages)
+	found = len(messages)
+	if w.opts.dryRun != nil {
+		if err := printStats(w.opts.dryRun, chat, Summarise(messages)); err != nil {
+			return found, 0, err
+		}
+		if !w.opts.retention.IsEmpty() && len(messages) > 0 {
+			// retention sorts messages newest first.
+			if err := printBoundary(w.opts.dryRun, messages[0]); err != nil {
+				return found, 0, err
+			}
+		}
+		return found, 0, nil
+	}
+	// planning: the messages are exported when the plan is made, as the
+	// plan does not contain the message contents.
+	if err := w.export(ctx, chat, messages); err != nil {
+		return found, 0, err
+	}
+	w.opts.plan.add(chat, w.opts.filter, messages)
+	return found, 0, nil
 }
 
 func findIdxOf(chats []mtp.Entity, id int64) (int, error) {
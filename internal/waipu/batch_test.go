@@ -0,0 +1,150 @@
+package waipu
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"iter"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/gotd/td/telegram/query/messages"
+	"github.com/gotd/td/tg"
+	mtp "github.com/rusq/mtpwrap"
+)
+
+// fakeTelegram is the Telegramer that serves messages from memory.
+type fakeTelegram struct {
+	chats    []mtp.Entity
+	messages map[int64][]messages.Elem
+	deleted  map[int64][]int
+}
+
+func newFakeTelegram() *fakeTelegram {
+	return &fakeTelegram{
+		messages: make(map[int64][]messages.Elem),
+		deleted:  make(map[int64][]int),
+	}
+}
+
+// addChat adds the chat with id and title, and the messages with ids sent
+// at dates.
+func (ft *fakeTelegram) addChat(id int64, title string, msgs ...messages.Elem) {
+	ft.chats = append(ft.chats, &tg.Chat{ID: id, Title: title})
+	ft.messages[id] = msgs
+}
+
+func (ft *fakeTelegram) GetChats(context.Context) ([]mtp.Entity, error) {
+	return ft.chats, nil
+}
+
+// IterMyMessages iterates over the messages of the chat, newest first.
+func (ft *fakeTelegram) IterMyMessages(_ context.Context, dlg mtp.Entity, offsetID int, before time.Time) iter.Seq2[messages.Elem, error] {
+	msgs := slices.Clone(ft.messages[dlg.GetID()])
+	slices.SortFunc(msgs, func(a, b messages.Elem) int { return b.Msg.GetID() - a.Msg.GetID() })
+	return func(yield func(messages.Elem, error) bool) {
+		for _, m := range msgs {
+			if offsetID > 0 && m.Msg.GetID() >= offsetID {
+				continue
+			}
+			if !before.IsZero() && !msgDate(m).Before(before) {
+				continue
+			}
+			if !yield(m, nil) {
+				return
+			}
+		}
+	}
+}
+
+func (ft *fakeTelegram) DeleteMessages(_ context.Context, dlg mtp.Entity, msgs []messages.Elem) (int, error) {
+	for _, m := range msgs {
+		ft.deleted[dlg.GetID()] = append(ft.deleted[dlg.GetID()], m.Msg.GetID())
+	}
+	return len(msgs), nil
+}
+
+// targets resolves the selector specs to the targets.
+func targets(t *testing.T, cl Telegramer, specs ...string) Targets {
+	t.Helper()
+	sel, err := ParseSelector(specs...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tgt, err := ResolveTargets(context.Background(), cl, sel)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return tgt
+}
+
+func TestBatch(t *testing.T) {
+	ft := newFakeTelegram()
+	ft.addChat(1, "one",
+		testMsg(10, date("2020-01-01")),
+		testMsg(11, date("2021-01-01")),
+		testMsg(12, date("2022-01-01")),
+	)
+	ft.addChat(2, "two", testMsg(20, date("2020-01-01")))
+
+	// chat 3 does not exist.
+	err := Batch(context.Background(), ft, targets(t, ft, "1", "3"), WithFilter(Filter{Before: date("2021-06-01")}))
+	if !errors.Is(err, ErrChatNotFound) {
+		t.Fatalf("Batch() error = %v, want %v", err, ErrChatNotFound)
+	}
+	// messages are scanned and deleted newest first.
+	if got, want := ft.deleted[1], []int{11, 10}; !slices.Equal(got, want) {
+		t.Errorf("deleted = %v, want %v", got, want)
+	}
+	if len(ft.deleted[2]) != 0 {
+		t.Errorf("chat 2 was not requested, but messages were deleted: %v", ft.deleted[2])
+	}
+}
+
+func TestWiper_ScanDateRange(t *testing.T) {
+	ft := newFakeTelegram()
+	ft.addChat(1, "one",
+		testMsg(10, date("2019-01-01")),
+		testMsg(11, date("2020-01-01")),
+		testMsg(12, date("2021-01-01")),
+		testMsg(13, date("2022-01-01")),
+		testMsg(14, date("2023-01-01")),
+	)
+	w := NewWiper(ft, WithFilter(Filter{After: date("2020-01-01"), Before: date("2022-01-01")}))
+	scanned := 0
+	msgs, err := w.Scan(context.Background(), ft.chats[0], func(n int) { scanned += n })
+	if err != nil {
+		t.Fatalf("Scan() error = %v", err)
+	}
+	var got []int
+	for _, m := range msgs {
+		got = append(got, m.Msg.GetID())
+	}
+	if want := []int{12, 11}; !slices.Equal(got, want) {
+		t.Errorf("found = %v, want %v", got, want)
+	}
+	// the messages outside of the date range are not scanned.
+	if scanned != 2 {
+		t.Errorf("scanned = %d, want 2", scanned)
+	}
+}
+
+func TestBatch_dryRun(t *testing.T) {
+	ft := newFakeTelegram()
+	ft.addChat(1, "one",
+		testMsg(10, time.Date(2020, 1, 1, 0, 0, 0, 0, time.Local)),
+		messages.Elem{Msg: &tg.Message{ID: 11, Date: int(date("2021-01-01").Unix()), Media: &tg.MessageMediaPhoto{}}},
+	)
+	var buf bytes.Buffer
+	if err := Batch(context.Background(), ft, targets(t, ft, "1"), WithDryRun(&buf)); err != nil {
+		t.Fatalf("Batch() error = %v", err)
+	}
+	if len(ft.deleted) != 0 {
+		t.Errorf("dry run deleted messages: %v", ft.deleted)
+	}
+	want := "1 (one): 2 messages to delete, 2020-01-01 00:00:00 .. 2021-01-01 00:00:00\n\tphoto: 1, text: 1\n"
+	if buf.String() != want {
+		t.Errorf("report = %q, want %q", buf.String(), want)
+	}
+}
@@ -0,0 +1,204 @@
+package waipu
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/rusq/dlog"
+	mtp "github.com/rusq/mtpwrap"
+)
+
+// ErrLimitReached is returned, if the run was stopped, because the run
+// limits were reached, see Limits.
+var ErrLimitReached = errors.New("the run limit is reached")
+
+// Limits are the limits of one run, so that the large wipes can be spread
+// over several runs.  Zero values mean no limit.
+type Limits struct {
+	// MaxMessages is the maximum number of messages deleted in one run.
+	MaxMessages int
+	// MaxDuration is the maximum duration of the run.
+	MaxDuration time.Duration
+}
+
+// IsEmpty returns true if there are no limits.
+func (l Limits) IsEmpty() bool {
+	return l.MaxMessages <= 0 && l.MaxDuration <= 0
+}
+
+func (l Limits) String() string {
+	if l.IsEmpty() {
+		return "none"
+	}
+	var parts []string
+	if l.MaxMessages > 0 {
+		parts = append(parts, fmt.Sprintf("%d messages", l.MaxMessages))
+	}
+	if l.MaxDuration > 0 {
+		parts = append(parts, l.MaxDuration.String())
+	}
+	return strings.Join(parts, ", ")
+}
+
+// WithLimits sets the limits of the run.  The limits apply to Batch and
+// RunRules, and to each run of the Daemon, and only when the messages are
+// deleted.  Once a limit is reached, the chat that is being wiped is
+// stopped, its checkpoint is kept, and the rest of the chats are reported
+// as stopped.  The next run continues the stopped chat from the checkpoint,
+// if the checkpoints are set, see Checkpoint.Limited.
+func WithLimits(l Limits) Option {
+	return func(o *options) {
+		o.limits = l
+	}
+}
+
+// budget is what is left of the run limits.  All methods are safe to call on
+// the nil budget, that has no limits.
+type budget struct {
+	mu       sync.Mutex
+	limits   Limits
+	deadline time.Time
+	used     int
+}
+
+// newBudget starts the run with the limits l.  It returns nil, if there are
+// no limits.
+func newBudget(l Limits) *budget {
+	if l.IsEmpty() {
+		return nil
+	}
+	b := &budget{limits: l}
+	if l.MaxDuration > 0 {
+		b.deadline = time.Now().Add(l.MaxDuration)
+	}
+	return b
+}
+
+// startBudget starts the budget of the run in the deletion mode.
+func (w *Wiper) startBudget() *budget {
+	if w.opts.deletes() {
+		w.opts.budget = newBudget(w.opts.limits)
+	}
+	return w.opts.budget
+}
+
+// expired returns ErrLimitReached, if the run took longer than allowed.
+func (b *budget) expired() error {
+	if b == nil {
+		return nil
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.expiredLocked()
+}
+
+func (b *budget) expiredLocked() error {
+	if !b.deadline.IsZero() && time.Now().After(b.deadline) {
+		return fmt.Errorf("%w: the run took longer than %s", ErrLimitReached, b.limits.MaxDuration)
+	}
+	return nil
+}
+
+// check returns ErrLimitReached, if any of the limits is reached.
+func (b *budget) check() error {
+	if b == nil {
+		return nil
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.checkLocked()
+}
+
+func (b *budget) checkLocked() error {
+	if err := b.expiredLocked(); err != nil {
+		return err
+	}
+	if b.limits.MaxMessages > 0 && b.used >= b.limits.MaxMessages {
+		return fmt.Errorf("%w: %d messages deleted", ErrLimitReached, b.used)
+	}
+	return nil
+}
+
+// take takes one message from the budget, or returns ErrLimitReached, if
+// the limits are reached.
+func (b *budget) take() error {
+	if b == nil {
+		return nil
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if err := b.checkLocked(); err != nil {
+		return err
+	}
+	b.used++
+	return nil
+}
+
+// stoppedChats are the chats that were not wiped to the end, because the run
+// limits were reached.
+type stoppedChats struct {
+	chats   []mtp.Entity
+	results []ChatResult
+}
+
+// add adds the chat with its result.  The chats that were not started have
+// the result with the status StatusStopped and the error err.
+func (s *stoppedChats) add(chat mtp.Entity, res ChatResult, err error) {
+	if res.Status == "" {
+		res = ChatResult{
+			ID:     chat.GetID(),
+			Title:  chat.GetTitle(),
+			Status: StatusStopped,
+			Error:  err.Error(),
+			Err:    err,
+		}
+	}
+	s.chats = append(s.chats, chat)
+	s.results = append(s.results, res)
+}
+
+// err returns the error of the first stopped chat, that matches
+// ErrLimitReached, or nil, if no chats were stopped.
+func (s *stoppedChats) err() error {
+	if len(s.results) == 0 {
+		return nil
+	}
+	return s.results[0].Err
+}
+
+// finish counts the messages left in the stopped chats, if cl can count
+// them, logs the chats and adds them to the report rep, if it is not nil.
+func (s *stoppedChats) finish(ctx context.Context, cl Telegramer, rule string, rep *Report) {
+	if len(s.chats) == 0 {
+		return
+	}
+	if mc, ok := cl.(MessageCounter); ok {
+		CountMessages(ctx, mc, s.chats, DefCountConcurrency, func(i int, count int, err error) {
+			if err != nil {
+				dlog.Debugf("chat %d: failed to count the messages left: %s", s.chats[i].GetID(), err)
+				return
+			}
+			s.results[i].Left = &count
+		})
+	}
+	prefix := ""
+	if rule != "" {
+		prefix = rule + ": "
+	}
+	dlog.Printf("LIMIT: %s%s, %d chats were not finished, the next run continues them", prefix, s.results[0].Error, len(s.chats))
+	for _, res := range s.results {
+		res.Rule = rule
+		if res.Left != nil {
+			dlog.Printf("STOPPED: %schat %d: messages deleted: %d, your messages left in the chat: %d", prefix, res.ID, res.Deleted, *res.Left)
+		} else {
+			dlog.Printf("STOPPED: %schat %d: messages deleted: %d", prefix, res.ID, res.Deleted)
+		}
+		if rep != nil {
+			rep.add(res)
+		}
+	}
+}
@@ -0,0 +1,191 @@
+package waipu
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gotd/td/telegram/query/messages"
+	mtp "github.com/rusq/mtpwrap"
+)
+
+// countingTelegram is the fake Telegram client, that counts the messages
+// left in the chat.
+type countingTelegram struct {
+	*fakeTelegram
+}
+
+func (ct countingTelegram) CountMyMessages(_ context.Context, chat mtp.Entity) (int, error) {
+	return len(ct.messages[chat.GetID()]) - len(ct.deleted[chat.GetID()]), nil
+}
+
+// manyMessages returns n messages with IDs from 1 to n, one minute apart.
+func manyMessages(n int) []messages.Elem {
+	var msgs []messages.Elem
+	for id := 1; id <= n; id++ {
+		msgs = append(msgs, testMsg(id, date("2020-01-01").Add(time.Duration(id)*time.Minute)))
+	}
+	return msgs
+}
+
+func TestBatch_limits(t *testing.T) {
+	tests := []struct {
+		name        string
+		limits      Limits
+		wantErr     error
+		wantStatus  []Status
+		wantDeleted []int
+		wantLeft    []int
+	}{
+		{"no limits", Limits{}, nil, []Status{StatusOK, StatusOK}, []int{250, 10}, nil},
+		{"enough messages", Limits{MaxMessages: 260}, nil, []Status{StatusOK, StatusOK}, []int{250, 10}, nil},
+		{"messages", Limits{MaxMessages: 150}, ErrLimitReached, []Status{StatusStopped, StatusStopped}, []int{150, 0}, []int{100, 10}},
+		{"exact messages", Limits{MaxMessages: 250}, ErrLimitReached, []Status{StatusOK, StatusStopped}, []int{250, 0}, []int{-1, 10}},
+		{"duration", Limits{MaxDuration: time.Nanosecond}, ErrLimitReached, []Status{StatusStopped, StatusStopped}, []int{0, 0}, []int{250, 10}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ft := newFakeTelegram()
+			ft.addChat(1, "big", manyMessages(250)...)
+			ft.addChat(2, "small", manyMessages(10)...)
+			cl := countingTelegram{ft}
+			cps, err := OpenCheckpoints(filepath.Join(t.TempDir(), "checkpoints.json"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			var rep Report
+			err = Batch(context.Background(), cl, targets(t, cl, "1", "2"), WithReport(&rep), WithCheckpoints(cps, false), WithLimits(tt.limits))
+			if !errors.Is(err, tt.wantErr) || (tt.wantErr == nil) != (err == nil) {
+				t.Errorf("Batch() error = %v, want %v", err, tt.wantErr)
+			}
+			if len(rep.Chats) != len(tt.wantStatus) {
+				t.Fatalf("report chats = %+v", rep.Chats)
+			}
+			for i, c := range rep.Chats {
+				if c.Status != tt.wantStatus[i] || c.Deleted != tt.wantDeleted[i] {
+					t.Errorf("chat %d: status = %s, deleted = %d, want %s, %d", c.ID, c.Status, c.Deleted, tt.wantStatus[i], tt.wantDeleted[i])
+				}
+				if len(ft.deleted[c.ID]) != c.Deleted {
+					t.Errorf("chat %d: %d messages deleted, reported %d", c.ID, len(ft.deleted[c.ID]), c.Deleted)
+				}
+				wantLeft := -1
+				if tt.wantLeft != nil {
+					wantLeft = tt.wantLeft[i]
+				}
+				if (wantLeft < 0) != (c.Left == nil) || (c.Left != nil && *c.Left != wantLeft) {
+					t.Errorf("chat %d: left = %v, want %d", c.ID, c.Left, wantLeft)
+				}
+			}
+			// the checkpoint of the chat that was stopped halfway is kept.
+			_, ok := cps.Get(1)
+			if want := rep.Chats[0].Status == StatusStopped && rep.Chats[0].Deleted > 0; ok != want {
+				t.Errorf("checkpoint of chat 1 is kept: %v, want %v", ok, want)
+			}
+		})
+	}
+}
+
+func TestBatch_limitsResume(t *testing.T) {
+	ft := newFakeTelegram()
+	ft.addChat(1, "big", manyMessages(250)...)
+	cps, err := OpenCheckpoints(filepath.Join(t.TempDir(), "checkpoints.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// each night deletes at most 100 messages, and continues from where the
+	// previous one stopped, without -resume.
+	var offsets []int
+	for night, want := range []int{100, 100, 50} {
+		var rep Report
+		cl := &flakyTelegram{fakeTelegram: ft}
+		err := Batch(context.Background(), cl, targets(t, ft, "1"), WithReport(&rep), WithCheckpoints(cps, false), WithLimits(Limits{MaxMessages: 100}))
+		offsets = append(offsets, cl.offsets...)
+		if night < 2 && !errors.Is(err, ErrLimitReached) {
+			t.Fatalf("night %d: Batch() error = %v, want %v", night+1, err, ErrLimitReached)
+		} else if night == 2 && err != nil {
+			t.Fatalf("night %d: Batch() error = %v", night+1, err)
+		}
+		if got := rep.Deleted; got != want {
+			t.Errorf("night %d: deleted %d, want %d", night+1, got, want)
+		}
+	}
+	got := slices.Clone(ft.deleted[1])
+	slices.Sort(got)
+	if want := ids(manyMessages(250)); !slices.Equal(got, want) {
+		t.Errorf("deleted %d messages, want 1 .. 250 once", len(got))
+	}
+	// the scan continues with the message over the limit.
+	if want := []int{0, 151, 51}; !slices.Equal(offsets, want) {
+		t.Errorf("scan offsets = %v, want %v", offsets, want)
+	}
+	if cps.Len() != 0 {
+		t.Errorf("checkpoints = %d, want 0", cps.Len())
+	}
+}
+
+// fakeExporter records the IDs of the exported messages.
+type fakeExporter struct {
+	ids []int
+}
+
+func (fe *fakeExporter) Export(_ context.Context, _ mtp.Entity, msgs []messages.Elem) error {
+	fe.ids = append(fe.ids, ids(msgs)...)
+	return nil
+}
+
+func TestBatch_limitsExport(t *testing.T) {
+	ft := newFakeTelegram()
+	ft.addChat(1, "one", manyMessages(5)...)
+	cps, err := OpenCheckpoints(filepath.Join(t.TempDir(), "checkpoints.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the stopped chat is scanned from the start, as the found messages
+	// have no contents to export, and each message is exported before it is
+	// deleted.
+	cl := &flakyTelegram{fakeTelegram: ft}
+	var fe fakeExporter
+	for range 2 {
+		_ = Batch(context.Background(), cl, targets(t, cl, "1"), WithCheckpoints(cps, false), WithExporter(&fe), WithLimits(Limits{MaxMessages: 3}))
+		// the deleted messages are gone from the chat.
+		ft.messages[1] = manyMessages(5 - len(ft.deleted[1]))
+	}
+	if !slices.Equal(cl.offsets, []int{0, 0}) {
+		t.Errorf("scan offsets = %v, want [0 0]", cl.offsets)
+	}
+	if want := []int{5, 4, 3, 2, 1}; !slices.Equal(fe.ids, want) || !slices.Equal(ft.deleted[1], want) {
+		t.Errorf("exported %v, deleted %v, want %v", fe.ids, ft.deleted[1], want)
+	}
+}
+
+func TestRunRules_limits(t *testing.T) {
+	ft := newFakeTelegram()
+	ft.addChat(1, "one", manyMessages(3)...)
+	ft.addChat(2, "two", manyMessages(4)...)
+	cfg, err := ReadConfig(strings.NewReader("rules:\n  - name: first\n    chats: [1]\n  - name: second\n    chats: [2]\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the limit is shared by the rules.
+	var (
+		rep Report
+		buf strings.Builder
+	)
+	err = RunRules(context.Background(), &buf, countingTelegram{ft}, cfg, WithReport(&rep), WithLimits(Limits{MaxMessages: 5}))
+	if !errors.Is(err, ErrLimitReached) {
+		t.Fatalf("RunRules() error = %v, want %v", err, ErrLimitReached)
+	}
+	if len(rep.Chats) != 2 {
+		t.Fatalf("report chats = %+v", rep.Chats)
+	}
+	if c := rep.Chats[0]; c.Rule != "first" || c.Status != StatusOK || c.Deleted != 3 {
+		t.Errorf("chat 1 = %+v", c)
+	}
+	if c := rep.Chats[1]; c.Rule != "second" || c.Status != StatusStopped || c.Deleted != 2 || c.Left == nil || *c.Left != 2 {
+		t.Errorf("chat 2 = %+v", c)
+	}
+}
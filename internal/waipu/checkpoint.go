@@ -0,0 +1,329 @@
+package waipu
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/gotd/td/telegram/query/messages"
+	"github.com/gotd/td/tg"
+	"github.com/rusq/dlog"
+	mtp "github.com/rusq/mtpwrap"
+)
+
+const (
+	// deleteChunk is the number of messages deleted at once, the deleted
+	// messages are recorded in the checkpoint after each chunk.
+	deleteChunk = 100
+	// checkpointInterval is the minimum interval between the checkpoint
+	// saves during the scan and deletion.  The checkpoint is always saved
+	// when the scan or deletion stops.
+	checkpointInterval = 5 * time.Second
+)
+
+// Checkpoint is the progress of wiping the chat.
+type Checkpoint struct {
+	ChatID int64 `json:"chat_id"`
+	// Criteria are the filter and retention of the wipe.  The checkpoint
+	// made with different criteria is not resumed.
+	Criteria string `json:"criteria"`
+	// Offset is the ID of the oldest message scanned, the scan is resumed
+	// from the older messages.
+	Offset int `json:"offset,omitempty"`
+	// Scanned is true, if the scan is complete.
+	Scanned bool `json:"scanned"`
+	// Found are the messages found by the scan, that match the filter, and
+	// Deleted are the IDs of the messages already deleted.  Wiper.Wipe
+	// removes the deleted messages from Found instead, and records the
+	// newest of them as Mark.
+	Found   []PlanMessage `json:"found,omitempty"`
+	Deleted []int         `json:"deleted,omitempty"`
+	Mark    PlanMessage   `json:"mark,omitzero"`
+	// Newest is the newest message scanned, it becomes the high-water mark
+	// of the chat, see WithMarks.
+	Newest PlanMessage `json:"newest,omitzero"`
+	// Limited is true, if the wipe was stopped by the run limits, see
+	// WithLimits, once all found messages were deleted.  Such checkpoint is
+	// continued by the next run with the same criteria, even if the resume
+	// is not requested, unless the messages are exported, see
+	// Checkpoints.start.
+	Limited bool      `json:"limited,omitempty"`
+	Updated time.Time `json:"updated"`
+}
+
+// Checkpoints is the persistent journal of the chat checkpoints.  The
+// checkpoint is removed, once the chat is wiped.
+type Checkpoints struct {
+	mu       sync.Mutex
+	filename string
+	chats    map[int64]*Checkpoint
+	saved    time.Time
+}
+
+// OpenCheckpoints opens the checkpoint journal file.  If the file does not
+// exist, the journal is empty, and the file is created on the first change.
+func OpenCheckpoints(filename string) (*Checkpoints, error) {
+	c := &Checkpoints{filename: filename, chats: make(map[int64]*Checkpoint)}
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return c, nil
+		}
+		return nil, err
+	}
+	var cps []*Checkpoint
+	if err := json.Unmarshal(data, &cps); err != nil {
+		return nil, fmt.Errorf("invalid checkpoint journal %s: %w", filename, err)
+	}
+	for _, cp := range cps {
+		c.chats[cp.ChatID] = cp
+	}
+	return c, nil
+}
+
+// WithCheckpoints records the progress of wiping each chat in the journal c.
+// If resume is true, the wipe continues from the checkpoint, if there is
+// one for the chat.  Checkpoints are not used in the dry-run and planning
+// modes, and are not resumed, if the messages are exported, as the messages
+// found before the interruption would be exported without the contents.
+func WithCheckpoints(c *Checkpoints, resume bool) Option {
+	return func(o *options) {
+		o.checkpoints = c
+		o.resume = resume
+	}
+}
+
+// Get returns the copy of the checkpoint of the chat.
+func (c *Checkpoints) Get(chatID int64) (Checkpoint, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	cp, ok := c.chats[chatID]
+	if !ok {
+		return Checkpoint{}, false
+	}
+	ret := *cp
+	ret.Found = slices.Clone(cp.Found)
+	ret.Deleted = slices.Clone(cp.Deleted)
+	return ret, true
+}
+
+// Len returns the number of the checkpoints.
+func (c *Checkpoints) Len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return len(c.chats)
+}
+
+// start returns the checkpoint of the chat to continue, if resume is true or
+// the previous run was stopped by the run limits, and the checkpoint was
+// made with the same criteria, or starts the new one.  If exporting is true,
+// the checkpoint is never continued, as the messages found by the previous
+// run have no contents to export.
+func (c *Checkpoints) start(chatID int64, criteria string, resume, exporting bool) (*Checkpoint, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if cp, ok := c.chats[chatID]; ok && !exporting && (resume || cp.Limited) {
+		if cp.Criteria == criteria {
+			if cp.Limited {
+				dlog.Printf("chat %d: continuing the wipe stopped by the run limit", chatID)
+			}
+			return cp, nil
+		}
+		dlog.Printf("chat %d: the checkpoint was made with different criteria (%s), starting over", chatID, cp.Criteria)
+	}
+	cp := &Checkpoint{ChatID: chatID, Criteria: criteria, Updated: time.Now()}
+	c.chats[chatID] = cp
+	return cp, c.save()
+}
+
+// update calls fn to update the checkpoint of the chat, and saves the
+// journal, if force is true or the last save was long enough ago.
+func (c *Checkpoints) update(chatID int64, force bool, fn func(cp *Checkpoint)) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	cp, ok := c.chats[chatID]
+	if !ok {
+		return nil
+	}
+	fn(cp)
+	cp.Updated = time.Now()
+	if !force && time.Since(c.saved) < checkpointInterval {
+		return nil
+	}
+	return c.save()
+}
+
+// remove removes the checkpoint of the chat.
+func (c *Checkpoints) remove(chatID int64) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if _, ok := c.chats[chatID]; !ok {
+		return nil
+	}
+	delete(c.chats, chatID)
+	return c.save()
+}
+
+// save writes the journal to the file.  It must be called with the mutex
+// held.
+func (c *Checkpoints) save() error {
+	cps := make([]*Checkpoint, 0, len(c.chats))
+	for _, cp := range c.chats {
+		cps = append(cps, cp)
+	}
+	slices.SortFunc(cps, func(a, b *Checkpoint) int { return a.Updated.Compare(b.Updated) })
+	data, err := json.Marshal(cps)
+	if err != nil {
+		return err
+	}
+	tmp := c.filename + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o600); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, c.filename); err != nil {
+		return err
+	}
+	c.saved = time.Now()
+	return nil
+}
+
+// checkpointed returns true, if the wiper records the checkpoints.
+func (w *Wiper) checkpointed() bool {
+	return w.opts.checkpoints != nil && w.opts.deletes()
+}
+
+// criteria returns the string that identifies the filter and retention of
+// the wiper.
+func (w *Wiper) criteria() string {
+	return w.opts.filter.String() + "; " + w.opts.retention.String()
+}
+
+// scanCheckpoint scans the chat down to the message with minID, recording
+// the progress in the checkpoint, or continues the scan from the checkpoint.
+func (w *Wiper) scanCheckpoint(ctx context.Context, chat mtp.Entity, minID int, cb func(n int)) ([]messages.Elem, error) {
+	cps := w.opts.checkpoints
+	id := chat.GetID()
+	cp, err := cps.start(id, w.criteria(), w.opts.resume, w.opts.exporter != nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to save the checkpoint: %w", err)
+	}
+	if cp.Offset > 0 || cp.Scanned {
+		dlog.Printf("chat %d: resuming, %d messages found, %d deleted", id, len(cp.Found), len(cp.Deleted))
+	}
+
+	// found are the messages found by this scan, with the contents.
+	found := make(map[int]messages.Elem)
+	if !cp.Scanned {
+		err := w.search(ctx, chat, cp.Offset, minID, cb, func(m messages.Elem) error {
+			match := w.opts.filter.Match(m)
+			if match {
+				found[m.Msg.GetID()] = m
+			}
+			return cps.update(id, false, func(cp *Checkpoint) {
+				if m.Msg.GetID() > cp.Newest.ID {
+					cp.Newest = planMessage(m)
+				}
+				if match {
+					cp.Found = append(cp.Found, planMessage(m))
+				}
+				cp.Offset = m.Msg.GetID()
+			})
+		})
+		if err != nil {
+			_ = cps.update(id, true, func(*Checkpoint) {})
+			return nil, err
+		}
+		if err := cps.update(id, true, func(cp *Checkpoint) { cp.Scanned = true }); err != nil {
+			return nil, fmt.Errorf("failed to save the checkpoint: %w", err)
+		}
+	}
+
+	// the messages found before the interruption have no contents.
+	snap, _ := cps.Get(id)
+	msgs := make([]messages.Elem, 0, len(snap.Found))
+	for _, pm := range snap.Found {
+		if m, ok := found[pm.ID]; ok {
+			msgs = append(msgs, m)
+		} else {
+			msgs = append(msgs, pm.elem())
+		}
+	}
+	// the retention is applied to all found messages, including the
+	// deleted ones, so that the same messages are kept.
+	all := msgs
+	msgs = w.opts.retention.Apply(msgs, time.Now())
+	w.setPending(id, markOf(snap.Newest, all, msgs))
+	deleted := make(map[int]bool, len(snap.Deleted))
+	for _, id := range snap.Deleted {
+		deleted[id] = true
+	}
+	msgs = slices.DeleteFunc(msgs, func(m messages.Elem) bool { return deleted[m.Msg.GetID()] })
+	if len(msgs) == 0 {
+		if err := cps.remove(id); err != nil {
+			return nil, fmt.Errorf("failed to save the checkpoint: %w", err)
+		}
+	}
+	return msgs, nil
+}
+
+// Discard drops the checkpoint of the chat, that was scanned by Scan, when its
+// messages are not going to be deleted, i.e. the deletion was not confirmed,
+// so that the later resume does not delete the found messages without the
+// confirmation.  The high-water mark of the chat does not move.
+func (w *Wiper) Discard(chat mtp.Entity) error {
+	w.setPending(chat.GetID(), PlanMessage{})
+	if !w.checkpointed() {
+		return nil
+	}
+	if err := w.opts.checkpoints.remove(chat.GetID()); err != nil {
+		return fmt.Errorf("failed to save the checkpoint: %w", err)
+	}
+	return nil
+}
+
+// deleteCheckpoint deletes the messages in chunks, recording the deleted
+// messages in the checkpoint.  Once all messages are deleted, the checkpoint
+// is removed.
+func (w *Wiper) deleteCheckpoint(ctx context.Context, chat mtp.Entity, msgs []messages.Elem) (int, error) {
+	cps := w.opts.checkpoints
+	id := chat.GetID()
+	total := 0
+	for chunk := range slices.Chunk(msgs, deleteChunk) {
+		n, err := w.cl.DeleteMessages(ctx, chat, chunk)
+		total += n
+		if err != nil {
+			_ = cps.update(id, true, func(*Checkpoint) {})
+			return total, err
+		}
+		if err := cps.update(id, false, func(cp *Checkpoint) {
+			for _, m := range chunk {
+				cp.Deleted = append(cp.Deleted, m.Msg.GetID())
+			}
+		}); err != nil {
+			return total, fmt.Errorf("failed to save the checkpoint: %w", err)
+		}
+	}
+	if err := cps.remove(id); err != nil {
+		return total, fmt.Errorf("failed to save the checkpoint: %w", err)
+	}
+	return total, nil
+}
+
+// planMessage returns the message m as the plan message.
+func planMessage(m messages.Elem) PlanMessage {
+	return PlanMessage{
+		ID:   m.Msg.GetID(),
+		Date: msgDate(m),
+		Type: KindOf(m),
+	}
+}
+
+// elem returns the message element, suitable for deletion.
+func (pm PlanMessage) elem() messages.Elem {
+	return messages.Elem{Msg: &tg.Message{ID: pm.ID, Date: int(pm.Date.Unix())}}
+}
@@ -0,0 +1,185 @@
+package waipu
+
+import (
+	"context"
+	"errors"
+	"iter"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/gotd/td/telegram/query/messages"
+	mtp "github.com/rusq/mtpwrap"
+)
+
+var errNetwork = errors.New("network is down")
+
+// flakyTelegram is the fake Telegram client that records the scan offsets,
+// and fails after failAfter messages are scanned or deleted.  Zero
+// failAfter never fails.
+type flakyTelegram struct {
+	*fakeTelegram
+	scanFailAfter   int
+	deleteFailAfter int
+
+	offsets []int
+	deleted int
+}
+
+func (ft *flakyTelegram) IterMyMessages(_ context.Context, dlg mtp.Entity, offsetID int, before time.Time) iter.Seq2[messages.Elem, error] {
+	ft.offsets = append(ft.offsets, offsetID)
+	return func(yield func(messages.Elem, error) bool) {
+		n := 0
+		for m := range ft.fakeTelegram.IterMyMessages(context.Background(), dlg, offsetID, before) {
+			if ft.scanFailAfter > 0 && n == ft.scanFailAfter {
+				yield(messages.Elem{}, errNetwork)
+				return
+			}
+			n++
+			if !yield(m, nil) {
+				return
+			}
+		}
+	}
+}
+
+func (ft *flakyTelegram) DeleteMessages(ctx context.Context, dlg mtp.Entity, msgs []messages.Elem) (int, error) {
+	if ft.deleteFailAfter > 0 && ft.deleted+len(msgs) > ft.deleteFailAfter {
+		return 0, errNetwork
+	}
+	ft.deleted += len(msgs)
+	return ft.fakeTelegram.DeleteMessages(ctx, dlg, msgs)
+}
+
+func TestWiper_resume(t *testing.T) {
+	ft := newFakeTelegram()
+	var msgs []messages.Elem
+	for id := 1; id <= 250; id++ {
+		msgs = append(msgs, testMsg(id, date("2020-01-01").Add(time.Duration(id)*time.Minute)))
+	}
+	ft.addChat(1, "big", msgs...)
+	chat := ft.chats[0]
+
+	filename := filepath.Join(t.TempDir(), "checkpoints.json")
+	open := func() *Checkpoints {
+		t.Helper()
+		cps, err := OpenCheckpoints(filename)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return cps
+	}
+	ctx := context.Background()
+
+	// the scan is interrupted after 120 messages.
+	cl := &flakyTelegram{fakeTelegram: ft, scanFailAfter: 120}
+	w := NewWiper(cl, WithCheckpoints(open(), false), WithRetention(Retention{KeepLast: 10}))
+	if _, err := w.Scan(ctx, chat, nil); !errors.Is(err, errNetwork) {
+		t.Fatalf("Scan() error = %v, want %v", err, errNetwork)
+	}
+	cp, ok := open().Get(1)
+	if !ok || cp.Offset != 131 || len(cp.Found) != 120 || cp.Scanned {
+		t.Fatalf("checkpoint after the scan: offset = %d, found = %d, scanned = %v", cp.Offset, len(cp.Found), cp.Scanned)
+	}
+
+	// the scan is resumed, and the deletion is interrupted after the first
+	// chunk.
+	cl = &flakyTelegram{fakeTelegram: ft, deleteFailAfter: deleteChunk}
+	w = NewWiper(cl, WithCheckpoints(open(), true), WithRetention(Retention{KeepLast: 10}))
+	found, err := w.Scan(ctx, chat, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !slices.Equal(cl.offsets, []int{131}) {
+		t.Errorf("scan offsets = %v, want [131]", cl.offsets)
+	}
+	if len(found) != 240 {
+		t.Fatalf("found = %d, want 240", len(found))
+	}
+	if n, err := w.Delete(ctx, chat, found); !errors.Is(err, errNetwork) || n != deleteChunk {
+		t.Fatalf("Delete() = %d, %v, want %d, %v", n, err, deleteChunk, errNetwork)
+	}
+
+	// the deletion is resumed without scanning.
+	cl = &flakyTelegram{fakeTelegram: ft}
+	w = NewWiper(cl, WithCheckpoints(open(), true), WithRetention(Retention{KeepLast: 10}))
+	found, err = w.Scan(ctx, chat, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(cl.offsets) != 0 {
+		t.Errorf("the complete scan was repeated from offsets %v", cl.offsets)
+	}
+	if len(found) != 140 {
+		t.Fatalf("found = %d, want 140", len(found))
+	}
+	if n, err := w.Delete(ctx, chat, found); err != nil || n != 140 {
+		t.Fatalf("Delete() = %d, %v, want 140", n, err)
+	}
+	if _, ok := open().Get(1); ok {
+		t.Error("the checkpoint was not removed after the chat was wiped")
+	}
+
+	deleted := slices.Clone(ft.deleted[1])
+	slices.Sort(deleted)
+	if len(deleted) != 240 || deleted[0] != 1 || deleted[len(deleted)-1] != 240 {
+		t.Errorf("deleted %d messages: %v .. %v, want 1 .. 240", len(deleted), deleted[0], deleted[len(deleted)-1])
+	}
+}
+
+func TestWiper_resumeCriteria(t *testing.T) {
+	ft := newFakeTelegram()
+	ft.addChat(1, "one", testMsg(10, date("2020-01-01")), testMsg(11, date("2022-01-01")))
+	cps, err := OpenCheckpoints(filepath.Join(t.TempDir(), "checkpoints.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	cl := &flakyTelegram{fakeTelegram: ft}
+	if _, err := NewWiper(cl, WithCheckpoints(cps, false), WithFilter(Filter{Before: date("2021-01-01")})).Scan(context.Background(), ft.chats[0], nil); err != nil {
+		t.Fatal(err)
+	}
+	// the checkpoint with the different filter is not resumed.
+	found, err := NewWiper(cl, WithCheckpoints(cps, true)).Scan(context.Background(), ft.chats[0], nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(found) != 2 || len(cl.offsets) != 2 {
+		t.Errorf("found = %d, scans = %d, want 2 and 2", len(found), len(cl.offsets))
+	}
+}
+
+func TestWiper_Discard(t *testing.T) {
+	ft := newFakeTelegram()
+	ft.addChat(1, "one", testMsg(10, date("2020-01-01")), testMsg(11, date("2022-01-01")))
+	cps, err := OpenCheckpoints(filepath.Join(t.TempDir(), "checkpoints.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	cl := &flakyTelegram{fakeTelegram: ft}
+	w := NewWiper(cl, WithCheckpoints(cps, false))
+	if _, err := w.Scan(context.Background(), ft.chats[0], nil); err != nil {
+		t.Fatal(err)
+	}
+	if cps.Len() != 1 {
+		t.Fatalf("checkpoints after scan = %d, want 1", cps.Len())
+	}
+	// the deletion was not confirmed.
+	if err := w.Discard(ft.chats[0]); err != nil {
+		t.Fatalf("Discard() error = %v", err)
+	}
+	if cps.Len() != 0 {
+		t.Errorf("checkpoints after discard = %d, want 0", cps.Len())
+	}
+	// the resumed wipe scans the chat again.
+	found, err := NewWiper(cl, WithCheckpoints(cps, true)).Scan(context.Background(), ft.chats[0], nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(found) != 2 || len(cl.offsets) != 2 {
+		t.Errorf("found = %d, scans = %d, want 2 and 2", len(found), len(cl.offsets))
+	}
+	if len(ft.deleted) != 0 {
+		t.Errorf("messages deleted: %v", ft.deleted)
+	}
+}
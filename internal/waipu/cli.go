@@ -2,6 +2,8 @@ package waipu
 
 import (
 	"context"
+	"iter"
+	"time"
 
 	"github.com/gotd/td/telegram/query/messages"
 	mtp "github.com/rusq/mtpwrap"
@@ -9,6 +11,33 @@ import (
 
 type Telegramer interface {
 	GetChats(ctx context.Context) ([]mtp.Entity, error)
-	SearchAllMyMessages(ctx context.Context, dlg mtp.Entity, cb func(n int)) ([]messages.Elem, error)
+	// IterMyMessages returns the iterator over the messages of the current
+	// user in the chat, newest first, starting with the message older than
+	// offsetID, or with the newest message, if offsetID is zero.  If before
+	// is not zero, only the messages sent before it are returned.  The
+	// messages are requested from Telegram as the iteration goes.
+	IterMyMessages(ctx context.Context, dlg mtp.Entity, offsetID int, before time.Time) iter.Seq2[messages.Elem, error]
 	DeleteMessages(ctx context.Context, dlg mtp.Entity, messages []messages.Elem) (int, error)
 }
+
+// PagedIterator is implemented by the Telegram clients, that request the
+// messages of IterMyMessages in pages.  IterMyMessagesPaged makes each page
+// request by calling do with the function that makes the request, so that
+// the Limiter paces and retries the page requests, see Limiter.Wrap.
+type PagedIterator interface {
+	IterMyMessagesPaged(ctx context.Context, dlg mtp.Entity, offsetID int, before time.Time, do func(ctx context.Context, request func() error) error) iter.Seq2[messages.Elem, error]
+}
+
+// Exporter saves the messages before they are deleted.
+type Exporter interface {
+	Export(ctx context.Context, chat mtp.Entity, msgs []messages.Elem) error
+}
+
+// BatchExporter is the optional interface of the Exporter, that saves the
+// messages of the chat wiped in batches, see Wiper.Wipe.  Append adds the
+// batch to the export of the chat, and Finish completes the export, once
+// the wipe of the chat stops.
+type BatchExporter interface {
+	Append(ctx context.Context, chat mtp.Entity, msgs []messages.Elem) error
+	Finish(chat mtp.Entity) error
+}
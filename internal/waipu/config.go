@@ -0,0 +1,268 @@
+package waipu
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"github.com/rusq/dlog"
+	"gopkg.in/yaml.v3"
+)
+
+// Config is the configuration file with the wipe rules.
+type Config struct {
+	Rules []Rule `yaml:"rules"`
+}
+
+// Rule is the wipe rule: it selects chats, and the messages in these chats
+// to be deleted.
+type Rule struct {
+	Name string `yaml:"name"`
+	// Chats is the list of chat selectors, see Selector.
+	Chats     []string      `yaml:"chats"`
+	Filter    RuleFilter    `yaml:"filter"`
+	Retention RuleRetention `yaml:"retention"`
+
+	selector  Selector
+	filter    Filter
+	retention Retention
+}
+
+// RuleFilter is the message filter of the rule.
+type RuleFilter struct {
+	After   string   `yaml:"after"`
+	Before  string   `yaml:"before"`
+	Types   []string `yaml:"types"`
+	Match   string   `yaml:"match"`
+	Exclude string   `yaml:"exclude"`
+}
+
+// RuleRetention is the retention of the rule.
+type RuleRetention struct {
+	KeepLast  int    `yaml:"keep_last"`
+	KeepNewer string `yaml:"keep_newer"`
+}
+
+// LoadConfig loads and validates the configuration file.
+func LoadConfig(filename string) (*Config, error) {
+	f, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return ReadConfig(f)
+}
+
+// ReadConfig reads and validates the configuration from r.
+func ReadConfig(r io.Reader) (*Config, error) {
+	var cfg Config
+	dec := yaml.NewDecoder(r)
+	dec.KnownFields(true)
+	if err := dec.Decode(&cfg); err != nil {
+		return nil, fmt.Errorf("invalid config: %w", err)
+	}
+	if len(cfg.Rules) == 0 {
+		return nil, errors.New("invalid config: no rules")
+	}
+	for i := range cfg.Rules {
+		if cfg.Rules[i].Name == "" {
+			cfg.Rules[i].Name = fmt.Sprintf("rule %d", i+1)
+		}
+		if err := cfg.Rules[i].compile(); err != nil {
+			return nil, fmt.Errorf("invalid config: %s: %w", cfg.Rules[i].Name, err)
+		}
+	}
+	return &cfg, nil
+}
+
+// compile parses the rule selectors, filters and retention.
+func (r *Rule) compile() error {
+	var err error
+	if r.selector, err = ParseSelector(r.Chats...); err != nil {
+		return err
+	}
+	if r.selector.IsEmpty() {
+		return errors.New("no chats")
+	}
+	if r.selector.HasPrivate() {
+		return errors.New("private chats are not supported (type:private)")
+	}
+	if r.filter.After, err = ParseDate(r.Filter.After); err != nil {
+		return err
+	}
+	if r.filter.Before, err = ParseDate(r.Filter.Before); err != nil {
+		return err
+	}
+	for _, t := range r.Filter.Types {
+		kinds, err := ParseKinds(t)
+		if err != nil {
+			return err
+		}
+		r.filter.Kinds = append(r.filter.Kinds, kinds...)
+	}
+	if r.filter.Content, err = ParseMatcher(r.Filter.Match); err != nil {
+		return err
+	}
+	if r.filter.ExcludeContent, err = ParseMatcher(r.Filter.Exclude); err != nil {
+		return err
+	}
+	if err := r.filter.Validate(); err != nil {
+		return err
+	}
+	r.retention.KeepLast = r.Retention.KeepLast
+	if r.retention.KeepNewer, err = ParseAge(r.Retention.KeepNewer); err != nil {
+		return err
+	}
+	return nil
+}
+
+// RuleSummary is the result of the rule run.
+type RuleSummary struct {
+	Name   string
+	Chats  int
+	Failed int
+	// Stopped is the number of the chats that were not finished, because
+	// the run limits were reached, see WithLimits.
+	Stopped  int
+	Messages int
+}
+
+// RunRules runs the rules of the configuration in order, and writes the
+// summary for each rule to w.  The rule filter and retention replace the
+// ones set in opts.
+//
+// The result of each chat is added to the report, if it is set with
+// WithReport, and, once the summary is written, the error of the report is
+// returned, see Report.Err.
+func RunRules(ctx context.Context, w io.Writer, cl Telegramer, cfg *Config, opts ...Option) error {
+	o := NewWiper(cl, opts...).opts
+	rep := o.report
+	if rep == nil {
+		rep = new(Report)
+		opts = append(opts, WithReport(rep))
+	}
+	rep.Started = time.Now()
+	defer rep.finish()
+
+	summaries, runErr := runRules(ctx, cl, cfg, opts...)
+	if runErr != nil && !errors.Is(runErr, context.Canceled) && !errors.Is(runErr, ErrLimitReached) {
+		return runErr
+	}
+	if err := printSummaries(w, summaries, o.deletes()); err != nil {
+		return err
+	}
+	if err := rep.Err(); err != nil {
+		return err
+	}
+	if runErr != nil {
+		// interrupted between the rules.
+		rep.Error = runErr.Error()
+	}
+	return runErr
+}
+
+// runRules runs the rules of the configuration in order, and returns the
+// summary for each rule.  If some of the chats were stopped by the run
+// limits, the summaries are returned with the error that matches
+// ErrLimitReached.
+func runRules(ctx context.Context, cl Telegramer, cfg *Config, opts ...Option) ([]RuleSummary, error) {
+	chats, err := cl.GetChats(ctx)
+	if err != nil {
+		return nil, err
+	}
+	// the limits are shared by all rules of the run.
+	b := NewWiper(cl, opts...).startBudget()
+	if b != nil {
+		dlog.Printf("run limits: %s", b.limits)
+	}
+	var (
+		summaries = make([]RuleSummary, 0, len(cfg.Rules))
+		limitErr  error
+	)
+	for _, rule := range cfg.Rules {
+		if err := ctx.Err(); err != nil {
+			return summaries, err
+		}
+		wpr := NewWiper(cl, append(opts, WithFilter(rule.filter), WithRetention(rule.retention))...)
+		wpr.opts.budget = b
+		sum := RuleSummary{Name: rule.Name}
+		targets, err := resolveTargets(ctx, cl, chats, rule.selector)
+		if err != nil {
+			return summaries, fmt.Errorf("%s: %w", rule.Name, err)
+		}
+		dlog.Printf("%s: %d chats selected (%s), filter: %s, retention: %s", rule.Name, len(targets.Chats), rule.selector, rule.filter, rule.retention)
+		for _, spec := range targets.Missing {
+			dlog.Printf("SKIPPED: %s: chat %s: chat not found", rule.Name, spec)
+			sum.Failed++
+		}
+		if rep := wpr.opts.report; rep != nil {
+			rep.notFound(rule.Name, targets.Missing)
+		}
+		var stopped stoppedChats
+		for i, chat := range targets.Chats {
+			if err := ctx.Err(); err != nil {
+				if rep := wpr.opts.report; rep != nil {
+					for _, res := range interrupted(rule.Name, targets.Chats[i:]) {
+						rep.add(res)
+					}
+				}
+				stopped.finish(ctx, cl, rule.Name, wpr.opts.report)
+				sum.Stopped = len(stopped.chats)
+				return append(summaries, sum), err
+			}
+			if err := b.check(); err != nil {
+				stopped.add(chat, ChatResult{}, err)
+				continue
+			}
+			res := wipeChat(ctx, wpr, chat)
+			res.Rule = rule.Name
+			if res.Status == StatusStopped {
+				sum.Messages += res.Deleted
+				stopped.add(chat, res, nil)
+				continue
+			}
+			if rep := wpr.opts.report; rep != nil {
+				rep.add(res)
+			}
+			if res.Status == StatusProtected {
+				dlog.Printf("SKIPPED: %s: chat %d: chat is protected", rule.Name, chat.GetID())
+				continue
+			}
+			if res.Status == StatusFailed || res.Status == StatusInterrupted {
+				dlog.Printf("SKIPPED: %s: chat %d: error deleting messages %s", rule.Name, chat.GetID(), res.Error)
+				sum.Failed++
+				continue
+			}
+			sum.Chats++
+			if wpr.opts.deletes() {
+				sum.Messages += res.Deleted
+			} else {
+				sum.Messages += res.Found
+			}
+		}
+		stopped.finish(ctx, cl, rule.Name, wpr.opts.report)
+		sum.Stopped = len(stopped.chats)
+		if limitErr == nil && sum.Stopped > 0 {
+			limitErr = fmt.Errorf("%s: %w", rule.Name, stopped.err())
+		}
+		summaries = append(summaries, sum)
+	}
+	return summaries, limitErr
+}
+
+func printSummaries(w io.Writer, summaries []RuleSummary, deletes bool) error {
+	msgHdr := "MESSAGES TO DELETE"
+	if deletes {
+		msgHdr = "MESSAGES DELETED"
+	}
+	tw := tabwriter.NewWriter(w, 0, 8, 2, ' ', 0)
+	fmt.Fprintf(tw, "RULE\tCHATS\tFAILED\tSTOPPED\t%s\n", msgHdr)
+	for _, s := range summaries {
+		fmt.Fprintf(tw, "%s\t%d\t%d\t%d\t%d\n", s.Name, s.Chats, s.Failed, s.Stopped, s.Messages)
+	}
+	return tw.Flush()
+}
@@ -0,0 +1,199 @@
+package waipu
+
+import (
+	"bytes"
+	"context"
+	"slices"
+	"strings"
+	"testing"
+)
+
+const testConfig = `
+rules:
+  - name: old photos
+    chats: [1, "title:/^two$/i"]
+    filter:
+      before: 2021-01-01
+      types: [photo]
+  - chats: ["type:group"]
+    retention:
+      keep_last: 1
+`
+
+func TestReadConfig(t *testing.T) {
+	cfg, err := ReadConfig(strings.NewReader(testConfig))
+	if err != nil {
+		t.Fatalf("ReadConfig() error = %v", err)
+	}
+	if len(cfg.Rules) != 2 {
+		t.Fatalf("rules = %d, want 2", len(cfg.Rules))
+	}
+	if got := cfg.Rules[1].Name; got != "rule 2" {
+		t.Errorf("default name = %q, want %q", got, "rule 2")
+	}
+	if got := cfg.Rules[0].selector.String(); got != "1,title:/^two$/i" {
+		t.Errorf("selector = %q", got)
+	}
+
+	for _, invalid := range []string{
+		"rules: []",
+		"rules: [{chats: []}]",
+		"rules: [{chats: [1], filter: {types: [selfie]}}]",
+		"rules: [{chats: [1], unknown: 1}]",
+		"rules: [{chats: [1], retention: {keep_newer: forever}}]",
+		"rules: [{chats: [\"type:private\"]}]",
+	} {
+		if _, err := ReadConfig(strings.NewReader(invalid)); err == nil {
+			t.Errorf("ReadConfig(%q) expected an error", invalid)
+		}
+	}
+}
+
+func TestRunRules(t *testing.T) {
+	ft := newFakeTelegram()
+	ft.addChat(1, "one", testMsg(10, date("2020-01-01")), testMsg(11, date("2022-01-01")))
+	ft.addChat(2, "Two", testMsg(20, date("2020-01-01")), testMsg(21, date("2020-02-01")))
+	ft.addChat(3, "three", testMsg(30, date("2020-01-01")))
+	// all test messages are text, so make the first rule delete text.
+	cfg, err := ReadConfig(strings.NewReader(strings.Replace(testConfig, "[photo]", "[text]", 1)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	if err := RunRules(context.Background(), &buf, ft, cfg); err != nil {
+		t.Fatalf("RunRules() error = %v", err)
+	}
+	// rule 1 deletes the old message 10 in chat 1, rule 2 keeps the last
+	// message in every chat.  The fake does not remove deleted messages, so
+	// message 10 is deleted by both rules.
+	if got := ft.deleted[1]; !slices.Equal(got, []int{10, 10}) {
+		t.Errorf("chat 1 deleted = %v", got)
+	}
+	if got := ft.deleted[3]; len(got) != 0 {
+		t.Errorf("chat 3 deleted = %v, want none", got)
+	}
+	if !strings.Contains(buf.String(), "old photos") {
+		t.Errorf("summary is missing the rule:\n%s", buf.String())
+	}
+}
+
+func TestRunRules_plan(t *testing.T) {
+	ft := newFakeTelegram()
+	ft.addChat(1, "one", testMsg(10, date("2020-01-01")))
+	ft.addChat(2, "Two", testMsg(20, date("2020-01-01")), testMsg(21, date("2020-02-01")))
+	cfg, err := ReadConfig(strings.NewReader(testConfig))
+	if err != nil {
+		t.Fatal(err)
+	}
+	plan := NewPlan(Identity{UserID: 42})
+	if err := RunRules(context.Background(), new(bytes.Buffer), ft, cfg, WithPlan(plan)); err != nil {
+		t.Fatalf("RunRules() error = %v", err)
+	}
+	if len(plan.Chats) == 0 {
+		t.Fatal("plan is empty")
+	}
+	// each chat records the filter of its rule.
+	for i, pc := range plan.Chats {
+		want := cfg.Rules[0].filter.String()
+		if i >= 2 {
+			want = cfg.Rules[1].filter.String()
+		}
+		if pc.Filter != want {
+			t.Errorf("chat %d (%d): filter = %q, want %q", i, pc.ID, pc.Filter, want)
+		}
+	}
+}
+
+func TestParseSelector(t *testing.T) {
+	chats := newFakeTelegram()
+	chats.addChat(1, "Crypto Moon")
+	chats.addChat(2, "Family")
+	chats.addChat(3, "crypto news")
+
+	tests := []struct {
+		specs   []string
+		want    []int64
+		wantErr bool
+	}{
+		{specs: []string{"2"}, want: []int64{2}},
+		{specs: []string{"title:/^crypto/i"}, want: []int64{1, 3}},
+		{specs: []string{"title:/^crypto/"}, want: []int64{3}},
+		{specs: []string{"title:MOON", "2"}, want: []int64{1, 2}},
+		{specs: []string{"type:group"}, want: []int64{1, 2, 3}},
+		{specs: []string{"type:channel"}, want: nil},
+		{specs: []string{"type:blog"}, wantErr: true},
+		{specs: []string{"title:/(/"}, wantErr: true},
+		{specs: []string{"title:"}, wantErr: true},
+		{specs: []string{"title:  "}, wantErr: true},
+		{specs: []string{"title://i"}, wantErr: true},
+		{specs: []string{"chat"}, wantErr: true},
+	}
+	for _, tt := range tests {
+		sel, err := ParseSelector(tt.specs...)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("ParseSelector(%v) error = %v, wantErr %v", tt.specs, err, tt.wantErr)
+			continue
+		}
+		var got []int64
+		for _, c := range sel.Select(chats.chats) {
+			got = append(got, c.GetID())
+		}
+		if !slices.Equal(got, tt.want) {
+			t.Errorf("ParseSelector(%v).Select() = %v, want %v", tt.specs, got, tt.want)
+		}
+	}
+}
+
+func TestSplitSelectors(t *testing.T) {
+	tests := []struct {
+		s    string
+		want []string
+	}{
+		{"1,2", []string{"1", "2"}},
+		{"title:/a,b/i,@user", []string{"title:/a,b/i", "@user"}},
+		{"title:/a{1,2}/,type:group", []string{"title:/a{1,2}/", "type:group"}},
+		{"title:/a,b", []string{"title:/a,b"}},
+		{"title:a,b", []string{"title:a", "b"}},
+	}
+	for _, tt := range tests {
+		if got := SplitSelectors(tt.s); !slices.Equal(got, tt.want) {
+			t.Errorf("SplitSelectors(%q) = %q, want %q", tt.s, got, tt.want)
+		}
+	}
+}
+
+func TestReadSelectors(t *testing.T) {
+	tests := []struct {
+		name    string
+		input   string
+		want    []string
+		wantErr bool
+	}{
+		{
+			"selectors and comments",
+			"# work chats\n12345\n\n  @somegroup  \ntitle:Crypto, news\n#67890\n",
+			[]string{"12345", "@somegroup", "title:Crypto, news"},
+			false,
+		},
+		{
+			"list tsv",
+			"id\ttitle\ttype\tusername\tmembers\tarchived\tfolders\n" +
+				"2\tCrypto\tmegagroup\tcrypto\t1000\ttrue\tGroups\n" +
+				"# 1\tFamily\tgroup\t\t4\tfalse\t\n",
+			[]string{"2"},
+			false,
+		},
+		{"invalid", "12345\nfolder:\n", nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ReadSelectors(strings.NewReader(tt.input))
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ReadSelectors() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("ReadSelectors() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
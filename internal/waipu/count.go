@@ -0,0 +1,48 @@
+package waipu
+
+import (
+	"context"
+	"sync"
+
+	mtp "github.com/rusq/mtpwrap"
+)
+
+// DefCountConcurrency is the default number of the concurrent requests made
+// by CountMessages.
+const DefCountConcurrency = 4
+
+// MessageCounter is implemented by the Telegram clients that can count the
+// messages of the user in the chat without fetching them.
+type MessageCounter interface {
+	CountMyMessages(ctx context.Context, chat mtp.Entity) (int, error)
+}
+
+// CountMessages counts the messages of the user in the chats, running at
+// most n requests at once.  The rate limits are handled by the client, see
+// Limiter.Wrap, so that the flood waits are shared with the rest of the run.
+// For each chat, cb is called with the index of the chat and the number of
+// messages or the error.  cb may be called concurrently.
+func CountMessages(ctx context.Context, cl MessageCounter, chats []mtp.Entity, n int, cb func(i int, count int, err error)) {
+	if n < 1 {
+		n = DefCountConcurrency
+	}
+	var (
+		wg  sync.WaitGroup
+		sem = make(chan struct{}, n)
+	)
+	for i, chat := range chats {
+		select {
+		case <-ctx.Done():
+			cb(i, 0, ctx.Err())
+			continue
+		case sem <- struct{}{}:
+		}
+		wg.Add(1)
+		go func() {
+			defer func() { <-sem; wg.Done() }()
+			count, err := cl.CountMyMessages(ctx, chat)
+			cb(i, count, err)
+		}()
+	}
+	wg.Wait()
+}
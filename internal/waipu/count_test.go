@@ -0,0 +1,125 @@
+package waipu
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"github.com/gotd/td/tgerr"
+	mtp "github.com/rusq/mtpwrap"
+)
+
+// fakeCounter is the fake Telegram client that counts the messages, it
+// implements all optional interfaces.  The first floodWaits requests are
+// rate limited.
+type fakeCounter struct {
+	fakeArchive
+	counts     map[int64]int
+	floodWaits int
+
+	mu       sync.Mutex
+	calls    int
+	active   atomic.Int32
+	maxConns int32
+}
+
+func (fc *fakeCounter) CountMyMessages(_ context.Context, chat mtp.Entity) (int, error) {
+	n := fc.active.Add(1)
+	defer fc.active.Add(-1)
+
+	fc.mu.Lock()
+	defer fc.mu.Unlock()
+	fc.maxConns = max(fc.maxConns, n)
+	fc.calls++
+	if fc.calls <= fc.floodWaits {
+		return 0, tgerr.New(420, "FLOOD_WAIT_0")
+	}
+	count, ok := fc.counts[chat.GetID()]
+	if !ok {
+		return 0, errors.New("chat not found")
+	}
+	return count, nil
+}
+
+func (fc *fakeCounter) ResolveUsername(context.Context, string) (mtp.Entity, error) {
+	return nil, errors.New("chat not found")
+}
+
+func TestCountMessages(t *testing.T) {
+	fc := &fakeCounter{
+		fakeArchive: newFakeArchive(),
+		counts:      map[int64]int{1: 10, 2: 20},
+		floodWaits:  1,
+	}
+	var (
+		mu  sync.Mutex
+		got = map[int]int{}
+	)
+	// the flood wait is handled by the limiter.
+	l, _ := OpenLimiter("")
+	mc, ok := l.Wrap(fc).(MessageCounter)
+	if !ok {
+		t.Fatal("the limited client does not implement MessageCounter")
+	}
+	CountMessages(context.Background(), mc, fc.chats, 1, func(i int, count int, err error) {
+		if err != nil {
+			t.Errorf("chat %d: unexpected error: %s", i, err)
+		}
+		mu.Lock()
+		got[i] = count
+		mu.Unlock()
+	})
+	if got[0] != 10 || got[1] != 20 {
+		t.Errorf("CountMessages() = %v", got)
+	}
+	if fc.calls != 3 {
+		t.Errorf("calls = %d, want 3", fc.calls)
+	}
+	if fc.maxConns != 1 {
+		t.Errorf("concurrent requests = %d, want 1", fc.maxConns)
+	}
+}
+
+func TestList_count(t *testing.T) {
+	// chat 2 fails to count.
+	fc := &fakeCounter{
+		fakeArchive: newFakeArchive(),
+		counts:      map[int64]int{1: 10},
+	}
+	tests := []struct {
+		name string
+		opts []ListOption
+		want string
+	}{
+		{
+			"text",
+			nil,
+			"              2 - Crypto\n              1 - Family, \"home\" (10 messages)\n",
+		},
+		{
+			"csv",
+			[]ListOption{WithListFormat(ListCSV)},
+			"id,title,type,username,members,archived,folders,messages\n" +
+				"2,Crypto,megagroup,crypto,1000,true,Groups,\n" +
+				"1,\"Family, \"\"home\"\"\",group,,4,false,Groups;Home,10\n",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			if err := List(context.Background(), &buf, fc, append(tt.opts, WithListCount(2))...); err != nil {
+				t.Fatalf("List() error = %v", err)
+			}
+			if got := buf.String(); got != tt.want {
+				t.Errorf("List() =\n%s\nwant:\n%s", got, tt.want)
+			}
+		})
+	}
+
+	if err := List(context.Background(), &bytes.Buffer{}, newFakeArchive(), WithListCount(2)); err == nil {
+		t.Error("List() with the client that can not count: want error")
+	}
+}
@@ -0,0 +1,170 @@
+package waipu
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"github.com/rusq/dlog"
+)
+
+// Daemon runs the wipe rules on schedule, until the context is cancelled.
+type Daemon struct {
+	// Config is the configuration with the wipe rules.
+	Config *Config
+	// Schedule is the schedule of the runs.
+	Schedule Schedule
+	// StateFile is the file to keep the state between the runs, if empty,
+	// the state is not saved.
+	StateFile string
+	// Output receives the summary of each run.
+	Output io.Writer
+}
+
+// DaemonState is the state of the daemon that persists between the runs.
+type DaemonState struct {
+	// Cycles is the number of the completed cycles.
+	Cycles int `json:"cycles"`
+	// LastRun is the start time of the last cycle.
+	LastRun time.Time `json:"last_run"`
+	// LastError is the error of the last cycle, if any.
+	LastError string `json:"last_error,omitempty"`
+	// Rules is the state of each rule, by the rule name.
+	Rules map[string]RuleState `json:"rules"`
+}
+
+// RuleState is the state of the rule.
+type RuleState struct {
+	LastRun time.Time `json:"last_run"`
+	// LastMessages is the number of messages processed in the last run.
+	LastMessages int `json:"last_messages"`
+	// TotalMessages is the number of messages processed in all runs.
+	TotalMessages int `json:"total_messages"`
+}
+
+// LoadDaemonState loads the daemon state from the file.  If the file does
+// not exist, it returns the empty state.
+func LoadDaemonState(filename string) (*DaemonState, error) {
+	st := DaemonState{Rules: make(map[string]RuleState)}
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return &st, nil
+		}
+		return nil, err
+	}
+	if err := json.Unmarshal(data, &st); err != nil {
+		return nil, fmt.Errorf("invalid daemon state file %s: %w", filename, err)
+	}
+	if st.Rules == nil {
+		st.Rules = make(map[string]RuleState)
+	}
+	return &st, nil
+}
+
+// Save saves the state to the file.
+func (st *DaemonState) Save(filename string) error {
+	data, err := json.MarshalIndent(st, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(filename, data, 0o600)
+}
+
+// update updates the state with the summaries of the cycle started at
+// start.
+func (st *DaemonState) update(start time.Time, summaries []RuleSummary, err error) {
+	st.Cycles++
+	st.LastRun = start
+	st.LastError = ""
+	if err != nil {
+		st.LastError = err.Error()
+	}
+	for _, s := range summaries {
+		rs := st.Rules[s.Name]
+		rs.LastRun = start
+		rs.LastMessages = s.Messages
+		rs.TotalMessages += s.Messages
+		st.Rules[s.Name] = rs
+	}
+}
+
+// Run runs the daemon.  If the scheduled run was missed while the daemon was
+// not running, the rules are run immediately.  Errors of the individual runs
+// are logged, and do not stop the daemon.  Run returns nil, when the context
+// is cancelled.
+func (d *Daemon) Run(ctx context.Context, cl Telegramer, opts ...Option) error {
+	st := &DaemonState{Rules: make(map[string]RuleState)}
+	if d.StateFile != "" {
+		var err error
+		if st, err = LoadDaemonState(d.StateFile); err != nil {
+			return err
+		}
+	}
+	output := d.Output
+	if output == nil {
+		output = io.Discard
+	}
+	deletes := NewWiper(cl, opts...).opts.deletes()
+
+	next := time.Now()
+	if !st.LastRun.IsZero() {
+		next = d.Schedule.Next(st.LastRun)
+	}
+	dlog.Printf("daemon: %d rules, schedule: %s, completed cycles: %d", len(d.Config.Rules), d.Schedule, st.Cycles)
+	for {
+		if next.IsZero() {
+			return fmt.Errorf("schedule %s has no next run", d.Schedule)
+		}
+		if wait := time.Until(next); wait > 0 {
+			dlog.Printf("daemon: next run at %s", next.Format(time.DateTime))
+			t := time.NewTimer(wait)
+			select {
+			case <-ctx.Done():
+				t.Stop()
+				dlog.Println("daemon: stopped")
+				return nil
+			case <-t.C:
+			}
+		}
+
+		start := time.Now()
+		cycle := st.Cycles + 1
+		dlog.Printf("daemon: cycle %d started", cycle)
+		summaries, err := runRules(ctx, cl, d.Config, opts...)
+		if ctx.Err() != nil {
+			// the cycle was interrupted, it will be repeated on the next
+			// start.
+			dlog.Printf("daemon: cycle %d interrupted", cycle)
+			return nil
+		}
+		if err != nil && !errors.Is(err, ErrLimitReached) {
+			dlog.Printf("daemon: cycle %d failed: %s", cycle, err)
+		} else {
+			if err != nil {
+				dlog.Printf("daemon: cycle %d stopped: %s, the next cycle continues the chats that were not finished", cycle, err)
+			}
+			if err := printSummaries(output, summaries, deletes); err != nil {
+				dlog.Printf("daemon: cycle %d: %s", cycle, err)
+			}
+		}
+		st.update(start, summaries, err)
+		if d.StateFile != "" {
+			if err := st.Save(d.StateFile); err != nil {
+				return fmt.Errorf("failed to save daemon state: %w", err)
+			}
+		}
+		dlog.Printf("daemon: cycle %d finished in %s", cycle, time.Since(start).Round(time.Second))
+
+		next = d.Schedule.Next(start)
+		if now := time.Now(); next.Before(now) {
+			// the cycle took longer than the interval, skip the missed
+			// runs.
+			next = d.Schedule.Next(now)
+		}
+	}
+}
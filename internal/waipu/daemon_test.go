@@ -0,0 +1,96 @@
+package waipu
+
+import (
+	"bytes"
+	"context"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/rusq/dlog"
+)
+
+func TestDaemon_Run(t *testing.T) {
+	ft := newFakeTelegram()
+	ft.addChat(1, "one", testMsg(10, date("2020-01-01")), testMsg(11, date("2022-01-01")))
+	cfg, err := ReadConfig(strings.NewReader(`rules: [{name: trim, chats: [1], retention: {keep_last: 1}}]`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	stateFile := filepath.Join(t.TempDir(), "daemon.json")
+	d := Daemon{Config: cfg, Schedule: every(20 * time.Millisecond), StateFile: stateFile}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 70*time.Millisecond)
+	defer cancel()
+	if err := d.Run(ctx, ft); err != nil {
+		t.Fatalf("Run() error = %v", err)
+	}
+
+	st, err := LoadDaemonState(stateFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if st.Cycles < 2 {
+		t.Errorf("cycles = %d, want at least 2", st.Cycles)
+	}
+	rs := st.Rules["trim"]
+	if rs.LastMessages != 1 || rs.TotalMessages != st.Cycles {
+		t.Errorf("rule state = %+v, want 1 message per cycle", rs)
+	}
+
+	// the state is kept between the runs.
+	cycles := st.Cycles
+	ctx, cancel = context.WithTimeout(context.Background(), 30*time.Millisecond)
+	defer cancel()
+	if err := d.Run(ctx, ft); err != nil {
+		t.Fatalf("Run() error = %v", err)
+	}
+	if st, err = LoadDaemonState(stateFile); err != nil {
+		t.Fatal(err)
+	}
+	if st.Cycles <= cycles {
+		t.Errorf("cycles = %d, want more than %d", st.Cycles, cycles)
+	}
+}
+
+func TestDaemon_Run_limits(t *testing.T) {
+	ft := newFakeTelegram()
+	ft.addChat(1, "one", manyMessages(3)...)
+	ft.addChat(2, "two", manyMessages(4)...)
+	cfg, err := ReadConfig(strings.NewReader("rules:\n  - name: first\n    chats: [1]\n  - name: second\n    chats: [2]\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var logs bytes.Buffer
+	defer dlog.SetOutput(dlog.Writer())
+	dlog.SetOutput(&logs)
+
+	stateFile := filepath.Join(t.TempDir(), "daemon.json")
+	var out strings.Builder
+	d := Daemon{Config: cfg, Schedule: every(time.Hour), StateFile: stateFile, Output: &out}
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	if err := d.Run(ctx, ft, WithLimits(Limits{MaxMessages: 5})); err != nil {
+		t.Fatalf("Run() error = %v", err)
+	}
+
+	if !strings.Contains(logs.String(), "daemon: cycle 1 stopped: second: the run limit is reached") {
+		t.Errorf("the stopped cycle is not logged:\n%s", logs.String())
+	}
+	st, err := LoadDaemonState(stateFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if st.Cycles != 1 || !strings.Contains(st.LastError, ErrLimitReached.Error()) {
+		t.Errorf("state: cycles = %d, last error = %q", st.Cycles, st.LastError)
+	}
+	if rs := st.Rules["second"]; rs.LastMessages != 2 {
+		t.Errorf("rule state = %+v, want 2 messages", rs)
+	}
+	// the summary is printed, with the stopped chat.
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	if len(lines) != 3 || strings.Join(strings.Fields(lines[2]), " ") != "second 0 0 1 2" {
+		t.Errorf("summary:\n%s", out.String())
+	}
+}
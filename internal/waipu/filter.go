@@ -0,0 +1,159 @@
+package waipu
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/gotd/td/telegram/query/messages"
+)
+
+// dateLayouts are the layouts accepted by ParseDate, in order of preference.
+var dateLayouts = []string{
+	time.RFC3339,
+	"2006-01-02T15:04:05",
+	"2006-01-02 15:04:05",
+	"2006-01-02 15:04",
+	"2006-01-02",
+}
+
+// ParseDate parses the date in one of the supported formats.  Dates without
+// the timezone are treated as local time.  Empty string returns zero time.
+func ParseDate(s string) (time.Time, error) {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return time.Time{}, nil
+	}
+	for _, layout := range dateLayouts {
+		if t, err := time.ParseInLocation(layout, s, time.Local); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("invalid date: %q, use YYYY-MM-DD or YYYY-MM-DDTHH:MM:SS", s)
+}
+
+// Filter selects which of the found messages should be deleted.  Zero value
+// selects all messages.
+type Filter struct {
+	// After, if set, selects messages sent at or after this time.
+	After time.Time
+	// Before, if set, selects messages sent before this time.
+	Before time.Time
+	// Kinds, if set, selects messages of these kinds only.
+	Kinds []Kind
+	// Content, if set, selects messages with the text or caption that
+	// matches.
+	Content *Matcher
+	// ExcludeContent, if set, skips messages with the text or caption that
+	// matches.
+	ExcludeContent *Matcher
+}
+
+// Validate checks the filter for consistency.
+func (f Filter) Validate() error {
+	if !f.After.IsZero() && !f.Before.IsZero() && !f.After.Before(f.Before) {
+		return errors.New("the \"after\" date must be earlier than the \"before\" date")
+	}
+	return nil
+}
+
+// IsEmpty returns true if the filter selects all messages.
+func (f Filter) IsEmpty() bool {
+	return f.After.IsZero() && f.Before.IsZero() && len(f.Kinds) == 0 &&
+		f.Content == nil && f.ExcludeContent == nil
+}
+
+// Match returns true if the message m satisfies the filter.
+func (f Filter) Match(m messages.Elem) bool {
+	if m.Msg == nil {
+		return f.IsEmpty()
+	}
+	date := msgDate(m)
+	if !f.After.IsZero() && date.Before(f.After) {
+		return false
+	}
+	if !f.Before.IsZero() && !date.Before(f.Before) {
+		return false
+	}
+	return f.matchKind(m) && f.matchContent(m)
+}
+
+// matchContent returns true if the message text satisfies the content
+// matchers.
+func (f Filter) matchContent(m messages.Elem) bool {
+	if f.Content == nil && f.ExcludeContent == nil {
+		return true
+	}
+	text := msgText(m)
+	if f.Content != nil && !f.Content.MatchString(text) {
+		return false
+	}
+	if f.ExcludeContent != nil && f.ExcludeContent.MatchString(text) {
+		return false
+	}
+	return true
+}
+
+// matchKind returns true if the message is of one of the filter kinds.
+func (f Filter) matchKind(m messages.Elem) bool {
+	if len(f.Kinds) == 0 {
+		return true
+	}
+	kind := KindOf(m)
+	for _, k := range f.Kinds {
+		if k == kind || (k == KForwarded && isForwarded(m)) {
+			return true
+		}
+	}
+	return false
+}
+
+// HasKind returns true if the kind k is selected by the filter.
+func (f Filter) HasKind(k Kind) bool {
+	return slices.Contains(f.Kinds, k)
+}
+
+// Apply returns the messages from msgs that satisfy the filter.
+func (f Filter) Apply(msgs []messages.Elem) []messages.Elem {
+	if f.IsEmpty() {
+		return msgs
+	}
+	var ret = make([]messages.Elem, 0, len(msgs))
+	for _, m := range msgs {
+		if f.Match(m) {
+			ret = append(ret, m)
+		}
+	}
+	return ret
+}
+
+// String returns the human readable representation of the filter.
+func (f Filter) String() string {
+	var parts []string
+	if !f.After.IsZero() {
+		parts = append(parts, "after "+f.After.Format(time.DateTime))
+	}
+	if !f.Before.IsZero() {
+		parts = append(parts, "before "+f.Before.Format(time.DateTime))
+	}
+	if len(f.Kinds) > 0 {
+		parts = append(parts, "types: "+JoinKinds(f.Kinds))
+	}
+	if f.Content != nil {
+		parts = append(parts, fmt.Sprintf("matching %q", f.Content))
+	}
+	if f.ExcludeContent != nil {
+		parts = append(parts, fmt.Sprintf("not matching %q", f.ExcludeContent))
+	}
+	if len(parts) == 0 {
+		return "all messages"
+	}
+	return strings.Join(parts, ", ")
+}
+
+// msgDate returns the date of the message.
+func msgDate(m messages.Elem) time.Time {
+	return time.Unix(int64(m.Msg.GetDate()), 0)
+}
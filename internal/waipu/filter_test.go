@@ -0,0 +1,100 @@
+package waipu
+
+import (
+	"testing"
+	"time"
+
+	"github.com/gotd/td/telegram/query/messages"
+	"github.com/gotd/td/tg"
+)
+
+func testMsg(id int, date time.Time) messages.Elem {
+	return messages.Elem{Msg: &tg.Message{ID: id, Date: int(date.Unix())}}
+}
+
+func date(s string) time.Time {
+	t, err := ParseDate(s)
+	if err != nil {
+		panic(err)
+	}
+	return t
+}
+
+func TestFilter_Match(t *testing.T) {
+	tests := []struct {
+		name   string
+		filter Filter
+		msg    messages.Elem
+		want   bool
+	}{
+		{
+			name: "empty filter matches everything",
+			msg:  testMsg(1, date("2020-01-01")),
+			want: true,
+		},
+		{
+			name:   "before the cutoff",
+			filter: Filter{Before: date("2021-01-01")},
+			msg:    testMsg(1, date("2020-12-31T23:59:59")),
+			want:   true,
+		},
+		{
+			name:   "before is exclusive",
+			filter: Filter{Before: date("2021-01-01")},
+			msg:    testMsg(1, date("2021-01-01")),
+			want:   false,
+		},
+		{
+			name:   "after is inclusive",
+			filter: Filter{After: date("2021-01-01")},
+			msg:    testMsg(1, date("2021-01-01")),
+			want:   true,
+		},
+		{
+			name:   "inside the window",
+			filter: Filter{After: date("2021-01-01"), Before: date("2022-01-01")},
+			msg:    testMsg(1, date("2021-06-01")),
+			want:   true,
+		},
+		{
+			name:   "outside the window",
+			filter: Filter{After: date("2021-01-01"), Before: date("2022-01-01")},
+			msg:    testMsg(1, date("2022-06-01")),
+			want:   false,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.filter.Match(tt.msg); got != tt.want {
+				t.Errorf("Filter.Match() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseDate(t *testing.T) {
+	tests := []struct {
+		name    string
+		s       string
+		want    time.Time
+		wantErr bool
+	}{
+		{"empty", "", time.Time{}, false},
+		{"date", "2022-02-24", time.Date(2022, 2, 24, 0, 0, 0, 0, time.Local), false},
+		{"date and time", "2022-02-24T04:30:00", time.Date(2022, 2, 24, 4, 30, 0, 0, time.Local), false},
+		{"rfc3339", "2022-02-24T04:30:00Z", time.Date(2022, 2, 24, 4, 30, 0, 0, time.UTC), false},
+		{"invalid", "24/02/2022", time.Time{}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseDate(tt.s)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("ParseDate() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if !got.Equal(tt.want) {
+				t.Errorf("ParseDate() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,90 @@
+package waipu
+
+import (
+	"context"
+	"slices"
+
+	"github.com/gotd/td/tg"
+	mtp "github.com/rusq/mtpwrap"
+)
+
+// FolderLister is implemented by the Telegram clients that can list the
+// chat folders.
+type FolderLister interface {
+	DialogFilters(ctx context.Context) ([]tg.DialogFilterClass, error)
+}
+
+// Folder is the chat folder.
+type Folder struct {
+	Title string
+	// Include are the IDs of the chats added to the folder, and Exclude are
+	// the IDs of the chats excluded from it.
+	Include []int64
+	Exclude []int64
+	// Groups and Broadcasts are set, if the folder includes all groups or
+	// all channels.
+	Groups     bool
+	Broadcasts bool
+}
+
+// FoldersOf converts the dialog filters to folders.  The default "All
+// chats" filter is skipped.
+func FoldersOf(filters []tg.DialogFilterClass) []Folder {
+	var ret []Folder
+	for _, f := range filters {
+		switch f := f.(type) {
+		case *tg.DialogFilter:
+			ret = append(ret, Folder{
+				Title:      f.Title.Text,
+				Include:    peerIDs(f.PinnedPeers, f.IncludePeers),
+				Exclude:    peerIDs(f.ExcludePeers),
+				Groups:     f.Groups,
+				Broadcasts: f.Broadcasts,
+			})
+		case *tg.DialogFilterChatlist:
+			ret = append(ret, Folder{
+				Title:   f.Title.Text,
+				Include: peerIDs(f.PinnedPeers, f.IncludePeers),
+			})
+		}
+	}
+	return ret
+}
+
+// Contains returns true if the chat is in the folder.  The folder options
+// that depend on the chat state, i.e. "exclude muted", are not taken into
+// account.
+func (f Folder) Contains(chat mtp.Entity) bool {
+	id := chat.GetID()
+	if slices.Contains(f.Exclude, id) {
+		return false
+	}
+	if slices.Contains(f.Include, id) {
+		return true
+	}
+	switch ChatType(chat) {
+	case "group", "megagroup", "gigagroup":
+		return f.Groups
+	case "channel":
+		return f.Broadcasts
+	}
+	return false
+}
+
+// peerIDs returns the IDs of the peers.
+func peerIDs(lists ...[]tg.InputPeerClass) []int64 {
+	var ret []int64
+	for _, peers := range lists {
+		for _, p := range peers {
+			switch p := p.(type) {
+			case *tg.InputPeerChat:
+				ret = append(ret, p.ChatID)
+			case *tg.InputPeerChannel:
+				ret = append(ret, p.ChannelID)
+			case *tg.InputPeerUser:
+				ret = append(ret, p.UserID)
+			}
+		}
+	}
+	return ret
+}
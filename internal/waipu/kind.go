@@ -0,0 +1,140 @@
+package waipu
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/gotd/td/telegram/query/messages"
+	"github.com/gotd/td/tg"
+)
+
+// Kind is the kind of the message content.
+type Kind string
+
+const (
+	KText     Kind = "text"
+	KPhoto    Kind = "photo"
+	KVideo    Kind = "video"
+	KDocument Kind = "document"
+	KVoice    Kind = "voice"
+	KRound    Kind = "round"
+	KSticker  Kind = "sticker"
+	KGIF      Kind = "gif"
+	KLink     Kind = "link"
+	KPoll     Kind = "poll"
+	KService  Kind = "service"
+	KOther    Kind = "other"
+
+	// KForwarded is not returned by KindOf, as forwarded message can be of
+	// any kind, but it can be used in the filter.
+	KForwarded Kind = "forwarded"
+)
+
+// FilterKinds lists the kinds that can be used in the filter.
+var FilterKinds = []Kind{
+	KText, KPhoto, KVideo, KDocument, KVoice, KRound, KSticker, KGIF, KLink, KPoll, KForwarded,
+}
+
+// ParseKinds parses the comma separated list of kinds.
+func ParseKinds(s string) ([]Kind, error) {
+	var ret []Kind
+	for _, name := range strings.Split(s, ",") {
+		k := Kind(strings.ToLower(strings.TrimSpace(name)))
+		if k == "" {
+			continue
+		}
+		if !k.valid() {
+			return nil, fmt.Errorf("unknown message type: %q, must be one of: %s", name, JoinKinds(FilterKinds))
+		}
+		ret = append(ret, k)
+	}
+	return ret, nil
+}
+
+func (k Kind) valid() bool {
+	return slices.Contains(FilterKinds, k)
+}
+
+// JoinKinds returns the comma separated list of kinds.
+func JoinKinds(kk []Kind) string {
+	ss := make([]string, len(kk))
+	for i := range kk {
+		ss[i] = string(kk[i])
+	}
+	return strings.Join(ss, ", ")
+}
+
+// isForwarded returns true if the message was forwarded.
+func isForwarded(m messages.Elem) bool {
+	msg, ok := m.Msg.(*tg.Message)
+	if !ok {
+		return false
+	}
+	_, ok = msg.GetFwdFrom()
+	return ok
+}
+
+// KindOf returns the kind of the message m.
+func KindOf(m messages.Elem) Kind {
+	msg, ok := m.Msg.(*tg.Message)
+	if !ok {
+		return KService
+	}
+	switch media := msg.Media.(type) {
+	case nil, *tg.MessageMediaEmpty:
+		if hasLinks(msg.Entities) {
+			return KLink
+		}
+		return KText
+	case *tg.MessageMediaWebPage:
+		return KLink
+	case *tg.MessageMediaPhoto:
+		return KPhoto
+	case *tg.MessageMediaPoll:
+		return KPoll
+	case *tg.MessageMediaDocument:
+		doc, ok := media.Document.AsNotEmpty()
+		if !ok {
+			return KDocument
+		}
+		return docKind(doc)
+	}
+	return KOther
+}
+
+// docKind returns the kind of the document, based on its attributes.
+func docKind(doc *tg.Document) Kind {
+	var kind = KDocument
+	for _, attr := range doc.Attributes {
+		switch a := attr.(type) {
+		case *tg.DocumentAttributeSticker:
+			return KSticker
+		case *tg.DocumentAttributeAnimated:
+			// animated GIFs also have the video attribute.
+			return KGIF
+		case *tg.DocumentAttributeVideo:
+			if a.RoundMessage {
+				kind = KRound
+			} else {
+				kind = KVideo
+			}
+		case *tg.DocumentAttributeAudio:
+			if a.Voice {
+				kind = KVoice
+			}
+		}
+	}
+	return kind
+}
+
+// hasLinks returns true if any of the message entities is a link.
+func hasLinks(ents []tg.MessageEntityClass) bool {
+	for _, e := range ents {
+		switch e.(type) {
+		case *tg.MessageEntityURL, *tg.MessageEntityTextURL:
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,76 @@
+package waipu
+
+import (
+	"testing"
+
+	"github.com/gotd/td/telegram/query/messages"
+	"github.com/gotd/td/tg"
+)
+
+func docElem(attrs ...tg.DocumentAttributeClass) messages.Elem {
+	return messages.Elem{Msg: &tg.Message{Media: &tg.MessageMediaDocument{Document: &tg.Document{Attributes: attrs}}}}
+}
+
+func TestKindOf(t *testing.T) {
+	tests := []struct {
+		name string
+		m    messages.Elem
+		want Kind
+	}{
+		{"text", messages.Elem{Msg: &tg.Message{Message: "hi"}}, KText},
+		{"link entity", messages.Elem{Msg: &tg.Message{Message: "x.com", Entities: []tg.MessageEntityClass{&tg.MessageEntityURL{Length: 5}}}}, KLink},
+		{"web page", messages.Elem{Msg: &tg.Message{Media: &tg.MessageMediaWebPage{}}}, KLink},
+		{"photo", messages.Elem{Msg: &tg.Message{Media: &tg.MessageMediaPhoto{}}}, KPhoto},
+		{"poll", messages.Elem{Msg: &tg.Message{Media: &tg.MessageMediaPoll{}}}, KPoll},
+		{"service", messages.Elem{Msg: &tg.MessageService{}}, KService},
+		{"document", docElem(&tg.DocumentAttributeFilename{FileName: "a.pdf"}), KDocument},
+		{"video", docElem(&tg.DocumentAttributeVideo{}), KVideo},
+		{"round", docElem(&tg.DocumentAttributeVideo{RoundMessage: true}), KRound},
+		{"gif", docElem(&tg.DocumentAttributeVideo{}, &tg.DocumentAttributeAnimated{}), KGIF},
+		{"voice", docElem(&tg.DocumentAttributeAudio{Voice: true}), KVoice},
+		{"music", docElem(&tg.DocumentAttributeAudio{}), KDocument},
+		{"sticker", docElem(&tg.DocumentAttributeImageSize{}, &tg.DocumentAttributeSticker{}), KSticker},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := KindOf(tt.m); got != tt.want {
+				t.Errorf("KindOf() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFilter_kinds(t *testing.T) {
+	photo := messages.Elem{Msg: &tg.Message{Media: &tg.MessageMediaPhoto{}}}
+	fwdText := messages.Elem{Msg: &tg.Message{Message: "fwd", FwdFrom: tg.MessageFwdHeader{FromName: "someone"}}}
+	fwdText.Msg.(*tg.Message).SetFlags()
+	text := messages.Elem{Msg: &tg.Message{Message: "hi"}}
+
+	f := Filter{Kinds: []Kind{KPhoto, KForwarded}}
+	for _, tt := range []struct {
+		name string
+		m    messages.Elem
+		want bool
+	}{
+		{"photo", photo, true},
+		{"forwarded text", fwdText, true},
+		{"text", text, false},
+	} {
+		if got := f.Match(tt.m); got != tt.want {
+			t.Errorf("%s: Match() = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestParseKinds(t *testing.T) {
+	got, err := ParseKinds("Photo, voice,,forwarded")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if JoinKinds(got) != "photo, voice, forwarded" {
+		t.Errorf("ParseKinds() = %v", got)
+	}
+	if _, err := ParseKinds("photo,selfie"); err == nil {
+		t.Error("ParseKinds() expected an error for unknown type")
+	}
+}
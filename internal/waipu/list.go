@@ -2,23 +2,255 @@ package waipu
 
 import (
 	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
-	"sort"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/gotd/td/tg"
+	"github.com/rusq/dlog"
+	mtp "github.com/rusq/mtpwrap"
+)
+
+// ListFormat is the output format of the chat list.
+type ListFormat string
+
+const (
+	ListText ListFormat = "text"
+	ListJSON ListFormat = "json"
+	ListCSV  ListFormat = "csv"
+	ListTSV  ListFormat = "tsv"
 )
 
-func List(ctx context.Context, w io.Writer, cl Telegramer) error {
+// ParseListFormat parses the chat list format.
+func ParseListFormat(s string) (ListFormat, error) {
+	switch f := ListFormat(strings.ToLower(s)); f {
+	case ListText, ListJSON, ListCSV, ListTSV:
+		return f, nil
+	}
+	return "", fmt.Errorf("invalid list format: %q, must be one of: text, json, csv, tsv", s)
+}
+
+// ArchiveLister is implemented by the Telegram clients that can list the
+// archived chats.
+type ArchiveLister interface {
+	ArchivedChats(ctx context.Context) ([]int64, error)
+}
+
+// ChatInfo is the chat in the chat list.
+type ChatInfo struct {
+	ID       int64    `json:"id"`
+	Title    string   `json:"title"`
+	Type     string   `json:"type"`
+	Username string   `json:"username,omitempty"`
+	Members  int      `json:"members"`
+	Archived bool     `json:"archived"`
+	Folders  []string `json:"folders,omitempty"`
+	// Messages is the number of the user messages in the chat, it is set
+	// only if the messages are counted, see WithListCount.
+	Messages *int `json:"messages,omitempty"`
+}
+
+var listHeader = []string{"id", "title", "type", "username", "members", "archived", "folders"}
+
+// record returns the chat info as the CSV record.
+func (ci ChatInfo) record() []string {
+	return []string{
+		strconv.FormatInt(ci.ID, 10),
+		ci.Title,
+		ci.Type,
+		ci.Username,
+		strconv.Itoa(ci.Members),
+		strconv.FormatBool(ci.Archived),
+		strings.Join(ci.Folders, ";"),
+	}
+}
+
+// countRecord returns the chat info as the CSV record with the number of
+// messages.
+func (ci ChatInfo) countRecord() []string {
+	var n string
+	if ci.Messages != nil {
+		n = strconv.Itoa(*ci.Messages)
+	}
+	return append(ci.record(), n)
+}
+
+type listOptions struct {
+	format ListFormat
+	filter Selector
+	// count is the number of the concurrent requests counting the messages,
+	// zero disables counting.
+	count int
+}
+
+// ListOption is the option for List.
+type ListOption func(*listOptions)
+
+// WithListFormat sets the output format.
+func WithListFormat(f ListFormat) ListOption {
+	return func(o *listOptions) {
+		o.format = f
+	}
+}
+
+// WithListFilter lists only the chats selected by sel.
+func WithListFilter(sel Selector) ListOption {
+	return func(o *listOptions) {
+		o.filter = sel
+	}
+}
+
+// WithListCount adds the number of the user messages in each chat, counted
+// with at most n concurrent requests.  The client must implement
+// MessageCounter.
+func WithListCount(n int) ListOption {
+	return func(o *listOptions) {
+		o.count = n
+	}
+}
+
+// List writes the list of chats to w, sorted by title.  The archive flag and
+// the folders are included in the JSON, CSV and TSV formats, if cl supports
+// them, see ArchiveLister and FolderLister.
+func List(ctx context.Context, w io.Writer, cl Telegramer, opts ...ListOption) error {
+	o := listOptions{format: ListText}
+	for _, opt := range opts {
+		opt(&o)
+	}
 	chats, err := cl.GetChats(ctx)
 	if err != nil {
 		return err
 	}
-	sort.Slice(chats, func(i, j int) bool {
-		return chats[i].GetTitle() < chats[j].GetTitle()
+	if !o.filter.IsEmpty() {
+		t, err := resolveTargets(ctx, cl, chats, o.filter)
+		if err != nil {
+			return err
+		}
+		chats = t.Chats
+	}
+	sortByTitle(chats)
+	var counts []*int
+	if o.count > 0 {
+		mc, ok := cl.(MessageCounter)
+		if !ok {
+			return errors.New("counting messages is not supported by the client")
+		}
+		counts = countMessages(ctx, mc, chats, o.count)
+	}
+	if o.format == ListText {
+		for i, chat := range chats {
+			var err error
+			if counts != nil && counts[i] != nil {
+				_, err = fmt.Fprintf(w, "%15d - %s (%d messages)\n", chat.GetID(), chat.GetTitle(), *counts[i])
+			} else {
+				_, err = fmt.Fprintf(w, "%15d - %s\n", chat.GetID(), chat.GetTitle())
+			}
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	infos := chatInfos(ctx, cl, chats)
+	if counts != nil {
+		for i := range infos {
+			infos[i].Messages = counts[i]
+		}
+	}
+	switch o.format {
+	case ListJSON:
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(infos)
+	case ListCSV, ListTSV:
+		cw := csv.NewWriter(w)
+		if o.format == ListTSV {
+			cw.Comma = '\t'
+		}
+		header, record := listHeader, ChatInfo.record
+		if counts != nil {
+			header, record = append(slices.Clip(listHeader), "messages"), ChatInfo.countRecord
+		}
+		if err := cw.Write(header); err != nil {
+			return err
+		}
+		for _, ci := range infos {
+			if err := cw.Write(record(ci)); err != nil {
+				return err
+			}
+		}
+		cw.Flush()
+		return cw.Error()
+	}
+	return fmt.Errorf("unsupported list format: %q", o.format)
+}
+
+// countMessages counts the user messages in the chats.  The count is nil for
+// the chats where it failed, the errors are logged.
+func countMessages(ctx context.Context, cl MessageCounter, chats []mtp.Entity, n int) []*int {
+	counts := make([]*int, len(chats))
+	CountMessages(ctx, cl, chats, n, func(i int, count int, err error) {
+		if err != nil {
+			dlog.Printf("chat %d: failed to count the messages: %s", chats[i].GetID(), err)
+			return
+		}
+		counts[i] = &count
 	})
+	return counts
+}
+
+// chatInfos returns the information about the chats.  Errors getting the
+// archive and folders are logged, and the information is omitted.
+func chatInfos(ctx context.Context, cl Telegramer, chats []mtp.Entity) []ChatInfo {
+	var archived []int64
+	if al, ok := cl.(ArchiveLister); ok {
+		var err error
+		if archived, err = al.ArchivedChats(ctx); err != nil {
+			dlog.Printf("failed to get the archived chats: %s", err)
+		}
+	}
+	var folders []Folder
+	if fl, ok := cl.(FolderLister); ok {
+		if filters, err := fl.DialogFilters(ctx); err != nil {
+			dlog.Printf("failed to get the chat folders: %s", err)
+		} else {
+			folders = FoldersOf(filters)
+		}
+	}
+
+	infos := make([]ChatInfo, 0, len(chats))
 	for _, chat := range chats {
-		if _, err := fmt.Fprintf(w, "%15d - %s\n", chat.GetID(), chat.GetTitle()); err != nil {
-			return err
+		ci := ChatInfo{
+			ID:       chat.GetID(),
+			Title:    chat.GetTitle(),
+			Type:     ChatType(chat),
+			Members:  members(chat),
+			Archived: slices.Contains(archived, chat.GetID()),
+		}
+		ci.Username, _ = Username(chat)
+		for _, f := range folders {
+			if f.Contains(chat) {
+				ci.Folders = append(ci.Folders, f.Title)
+			}
 		}
+		infos = append(infos, ci)
+	}
+	return infos
+}
+
+// members returns the number of the chat members, if known.
+func members(chat mtp.Entity) int {
+	switch c := chat.(type) {
+	case *tg.Chat:
+		return c.ParticipantsCount
+	case *tg.Channel:
+		return c.ParticipantsCount
 	}
-	return nil
+	return 0
 }
@@ -0,0 +1,100 @@
+package waipu
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/gotd/td/tg"
+)
+
+// fakeArchive is the fake Telegram client with folders and the archive.
+type fakeArchive struct {
+	fakeFolders
+	archived []int64
+}
+
+func (fa fakeArchive) ArchivedChats(context.Context) ([]int64, error) {
+	return fa.archived, nil
+}
+
+func newFakeArchive() fakeArchive {
+	ft := newFakeTelegram()
+	ft.chats = append(ft.chats,
+		&tg.Chat{ID: 1, Title: "Family, \"home\"", ParticipantsCount: 4},
+		&tg.Channel{ID: 2, Title: "Crypto", Username: "crypto", Megagroup: true, ParticipantsCount: 1000},
+	)
+	return fakeArchive{
+		fakeFolders: fakeFolders{
+			fakeTelegram: ft,
+			filters: []tg.DialogFilterClass{
+				&tg.DialogFilter{Title: tg.TextWithEntities{Text: "Groups"}, Groups: true},
+				&tg.DialogFilter{Title: tg.TextWithEntities{Text: "Home"}, IncludePeers: []tg.InputPeerClass{&tg.InputPeerChat{ChatID: 1}}},
+			},
+		},
+		archived: []int64{2},
+	}
+}
+
+func TestList(t *testing.T) {
+	cl := newFakeArchive()
+	tests := []struct {
+		name string
+		opts []ListOption
+		want string
+	}{
+		{
+			"text",
+			nil,
+			"              2 - Crypto\n              1 - Family, \"home\"\n",
+		},
+		{
+			"csv",
+			[]ListOption{WithListFormat(ListCSV)},
+			"id,title,type,username,members,archived,folders\n" +
+				"2,Crypto,megagroup,crypto,1000,true,Groups\n" +
+				"1,\"Family, \"\"home\"\"\",group,,4,false,Groups;Home\n",
+		},
+		{
+			"tsv with filter",
+			[]ListOption{WithListFormat(ListTSV), WithListFilter(mustSelector(t, "type:megagroup"))},
+			"id\ttitle\ttype\tusername\tmembers\tarchived\tfolders\n" +
+				"2\tCrypto\tmegagroup\tcrypto\t1000\ttrue\tGroups\n",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			if err := List(context.Background(), &buf, cl, tt.opts...); err != nil {
+				t.Fatalf("List() error = %v", err)
+			}
+			if got := buf.String(); got != tt.want {
+				t.Errorf("List() =\n%s\nwant:\n%s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestList_json(t *testing.T) {
+	var buf bytes.Buffer
+	if err := List(context.Background(), &buf, newFakeArchive(), WithListFormat(ListJSON), WithListFilter(mustSelector(t, "@crypto"))); err != nil {
+		t.Fatalf("List() error = %v", err)
+	}
+	var got []ChatInfo
+	if err := json.Unmarshal(buf.Bytes(), &got); err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 1 || got[0].ID != 2 || !got[0].Archived || got[0].Members != 1000 {
+		t.Errorf("List() = %+v", got)
+	}
+}
+
+func mustSelector(t *testing.T, specs ...string) Selector {
+	t.Helper()
+	sel, err := ParseSelector(specs...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return sel
+}
@@ -0,0 +1,187 @@
+package waipu
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/gotd/td/telegram/query/messages"
+	"github.com/rusq/dlog"
+)
+
+// Mark is the high-water mark of the chat: all messages up to MessageID
+// were processed by the wipe with the Criteria, and are not scanned again.
+type Mark struct {
+	ChatID   int64  `json:"chat_id"`
+	Criteria string `json:"criteria"`
+	// MessageID and Date are the ID and the date of the newest processed
+	// message.
+	MessageID int       `json:"message_id"`
+	Date      time.Time `json:"date"`
+	Updated   time.Time `json:"updated"`
+}
+
+// Marks is the persistent list of the chat high-water marks.  Each chat has
+// a mark for each set of the criteria, so that the rules with different
+// filters do not reset each other's marks.  The list is saved on every
+// change.
+type Marks struct {
+	mu       sync.Mutex
+	filename string
+	marks    []Mark
+}
+
+// OpenMarks opens the high-water marks file.  If the file does not exist,
+// there are no marks, and the file is created on the first change.
+func OpenMarks(filename string) (*Marks, error) {
+	m := &Marks{filename: filename}
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return m, nil
+		}
+		return nil, err
+	}
+	if err := json.Unmarshal(data, &m.marks); err != nil {
+		return nil, fmt.Errorf("invalid high-water marks file %s: %w", filename, err)
+	}
+	return m, nil
+}
+
+// WithMarks enables the incremental wipes: only the messages newer than the
+// high-water mark of the chat are scanned, and the mark is moved after the
+// chat is wiped successfully.  If full is true, the existing marks are
+// ignored and the chats are scanned completely, but the marks are still
+// updated.  The marks are only updated, when the messages are deleted.
+func WithMarks(m *Marks, full bool) Option {
+	return func(o *options) {
+		o.marks = m
+		o.full = full
+	}
+}
+
+// Get returns the mark of the chat made with the criteria.
+func (m *Marks) Get(chatID int64, criteria string) (Mark, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	i := m.index(chatID, criteria)
+	if i < 0 {
+		return Mark{}, false
+	}
+	return m.marks[i], true
+}
+
+// set sets the mark and saves the list.
+func (m *Marks) set(mark Mark) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	mark.Updated = time.Now()
+	if i := m.index(mark.ChatID, mark.Criteria); i >= 0 {
+		m.marks[i] = mark
+	} else {
+		m.marks = append(m.marks, mark)
+	}
+	return m.save()
+}
+
+// index returns the index of the mark, or -1.  It must be called with the
+// mutex held.
+func (m *Marks) index(chatID int64, criteria string) int {
+	return slices.IndexFunc(m.marks, func(mk Mark) bool { return mk.ChatID == chatID && mk.Criteria == criteria })
+}
+
+// save writes the list to the file.  It must be called with the mutex
+// held.
+func (m *Marks) save() error {
+	data, err := json.MarshalIndent(m.marks, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp := m.filename + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, m.filename)
+}
+
+// minID returns the ID of the high-water mark of the chat, the messages with
+// this ID and older are not scanned.  It returns zero, if the wipe is not
+// incremental.
+func (w *Wiper) minID(chatID int64) int {
+	if w.opts.marks == nil || w.opts.full {
+		return 0
+	}
+	mark, ok := w.opts.marks.Get(chatID, w.criteria())
+	if !ok {
+		return 0
+	}
+	dlog.Debugf("chat %d: scanning the messages newer than %d (%s)", chatID, mark.MessageID, mark.Date.Format(time.DateTime))
+	return mark.MessageID
+}
+
+// markOf returns the mark of the chat after the messages are deleted.
+// newest is the newest scanned message, found are the messages that match
+// the filter, and del are the messages to delete.  It returns the zero mark,
+// if the mark does not move.
+//
+// If the retention keeps some of the found messages, they have to be scanned
+// again on the next run, as they may be deleted then, so the mark is set
+// below the oldest kept message.  The messages that do not match the filter
+// are never deleted with the same criteria, and can be skipped.
+func markOf(newest PlanMessage, found, del []messages.Elem) PlanMessage {
+	if len(found) == len(del) {
+		return newest
+	}
+	deleted := make(map[int]bool, len(del))
+	for _, m := range del {
+		deleted[m.Msg.GetID()] = true
+	}
+	oldestKept := 0
+	for _, m := range found {
+		if id := m.Msg.GetID(); !deleted[id] && (oldestKept == 0 || id < oldestKept) {
+			oldestKept = id
+		}
+	}
+	var mark PlanMessage
+	for _, m := range del {
+		if id := m.Msg.GetID(); id < oldestKept && id > mark.ID {
+			mark = planMessage(m)
+		}
+	}
+	return mark
+}
+
+// setPending remembers the mark of the chat, that is saved once the found
+// messages are deleted, see commitMark.
+func (w *Wiper) setPending(chatID int64, mark PlanMessage) {
+	if w.opts.marks == nil || !w.opts.deletes() {
+		return
+	}
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.pending == nil {
+		w.pending = make(map[int64]Mark)
+	}
+	if mark.ID == 0 {
+		// nothing new was processed, the mark stays.
+		delete(w.pending, chatID)
+		return
+	}
+	w.pending[chatID] = Mark{ChatID: chatID, Criteria: w.criteria(), MessageID: mark.ID, Date: mark.Date}
+}
+
+// commitMark saves the pending mark of the chat.
+func (w *Wiper) commitMark(chatID int64) error {
+	w.mu.Lock()
+	mark, ok := w.pending[chatID]
+	delete(w.pending, chatID)
+	w.mu.Unlock()
+	if !ok {
+		return nil
+	}
+	return w.opts.marks.set(mark)
+}
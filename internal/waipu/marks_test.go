@@ -0,0 +1,156 @@
+package waipu
+
+import (
+	"bytes"
+	"context"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/gotd/td/telegram/query/messages"
+)
+
+func TestWiper_marks(t *testing.T) {
+	ft := newFakeTelegram()
+	var msgs []messages.Elem
+	for id := 1; id <= 10; id++ {
+		msgs = append(msgs, testMsg(id, date("2020-01-01").Add(time.Duration(id)*time.Minute)))
+	}
+	ft.addChat(1, "one", msgs...)
+	chat := ft.chats[0]
+	marks, err := OpenMarks(filepath.Join(t.TempDir(), "marks.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+	retention := WithRetention(Retention{KeepLast: 3})
+
+	// wipe scans the chat, deletes the messages and returns the IDs of the
+	// deleted messages and the number of the scanned messages.
+	wipe := func(t *testing.T, opts ...Option) ([]int, int) {
+		t.Helper()
+		ft.deleted = make(map[int64][]int)
+		scanned := 0
+		w := NewWiper(&flakyTelegram{fakeTelegram: ft}, opts...)
+		found, err := w.Scan(ctx, chat, func(n int) { scanned += n })
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := w.Delete(ctx, chat, found); err != nil {
+			t.Fatal(err)
+		}
+		deleted := slices.Clone(ft.deleted[1])
+		slices.Sort(deleted)
+		return deleted, scanned
+	}
+	check := func(t *testing.T, gotDel []int, gotScanned int, wantDel []int, wantScanned, wantMark int) {
+		t.Helper()
+		if !slices.Equal(gotDel, wantDel) {
+			t.Errorf("deleted = %v, want %v", gotDel, wantDel)
+		}
+		if gotScanned != wantScanned {
+			t.Errorf("scanned = %d, want %d", gotScanned, wantScanned)
+		}
+		mark, _ := marks.Get(1, NewWiper(ft, retention).criteria())
+		if mark.MessageID != wantMark {
+			t.Errorf("mark = %d, want %d", mark.MessageID, wantMark)
+		}
+	}
+
+	del, scanned := wipe(t, retention, WithMarks(marks, false))
+	check(t, del, scanned, []int{1, 2, 3, 4, 5, 6, 7}, 10, 7)
+
+	// the fake client does not remove the deleted messages, they are not
+	// scanned again.  The kept messages are scanned.
+	del, scanned = wipe(t, retention, WithMarks(marks, false))
+	check(t, del, scanned, nil, 3, 7)
+
+	// new messages push the kept ones out.
+	ft.messages[1] = append(ft.messages[1], testMsg(11, date("2020-01-02")), testMsg(12, date("2020-01-03")))
+	del, scanned = wipe(t, retention, WithMarks(marks, false))
+	check(t, del, scanned, []int{8, 9}, 5, 9)
+
+	// the dry run does not move the mark.
+	w := NewWiper(&flakyTelegram{fakeTelegram: ft}, retention, WithMarks(marks, false), WithDryRun(new(bytes.Buffer)))
+	if _, err := w.Scan(ctx, chat, nil); err != nil {
+		t.Fatal(err)
+	}
+	check(t, nil, 0, nil, 0, 9)
+
+	// the full scan ignores the mark.
+	del, scanned = wipe(t, retention, WithMarks(marks, true))
+	check(t, del, scanned, []int{1, 2, 3, 4, 5, 6, 7, 8, 9}, 12, 9)
+
+	// the different criteria have their own mark.
+	del, scanned = wipe(t, WithMarks(marks, false))
+	if len(del) != 12 || scanned != 12 {
+		t.Errorf("without retention: deleted = %d, scanned = %d, want 12 and 12", len(del), scanned)
+	}
+	if mark, _ := marks.Get(1, NewWiper(ft).criteria()); mark.MessageID != 12 || !mark.Date.Equal(date("2020-01-03")) {
+		t.Errorf("mark without retention = %+v, want 12 at 2020-01-03", mark)
+	}
+	check(t, nil, 0, nil, 0, 9)
+
+	// the marks are saved.
+	reopened, err := OpenMarks(marks.filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if mark, ok := reopened.Get(1, NewWiper(ft, retention).criteria()); !ok || mark.MessageID != 9 {
+		t.Errorf("saved mark = %+v, %v, want 9", mark, ok)
+	}
+}
+
+func TestWiper_marksFailed(t *testing.T) {
+	ft := newFakeTelegram()
+	ft.addChat(1, "one", testMsg(1, date("2020-01-01")), testMsg(2, date("2020-01-02")))
+	marks, err := OpenMarks(filepath.Join(t.TempDir(), "marks.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	w := NewWiper(&flakyTelegram{fakeTelegram: ft, deleteFailAfter: 1}, WithMarks(marks, false))
+	found, err := w.Scan(context.Background(), ft.chats[0], nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := w.Delete(context.Background(), ft.chats[0], found); err == nil {
+		t.Fatal("Delete() succeeded, want the error")
+	}
+	if mark, ok := marks.Get(1, w.criteria()); ok {
+		t.Errorf("the mark %d was saved after the failed wipe", mark.MessageID)
+	}
+}
+
+func TestWiper_marksCheckpoints(t *testing.T) {
+	ft := newFakeTelegram()
+	ft.addChat(1, "one", testMsg(1, date("2020-01-01")), testMsg(2, date("2020-01-02")), testMsg(3, date("2020-01-03")))
+	dir := t.TempDir()
+	marks, err := OpenMarks(filepath.Join(dir, "marks.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	cps, err := OpenCheckpoints(filepath.Join(dir, "checkpoints.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+	// the second run scans only the kept message, and finds nothing.
+	for i, want := range []int{2, 0} {
+		cl := &flakyTelegram{fakeTelegram: ft}
+		w := NewWiper(cl, WithCheckpoints(cps, false), WithMarks(marks, false), WithRetention(Retention{KeepLast: 1}))
+		found, err := w.Scan(ctx, ft.chats[0], nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := w.Delete(ctx, ft.chats[0], found); err != nil {
+			t.Fatal(err)
+		}
+		if mark, _ := marks.Get(1, w.criteria()); mark.MessageID != 2 {
+			t.Errorf("run %d: mark = %d, want 2", i, mark.MessageID)
+		}
+		if len(cl.offsets) != 1 || len(found) != want {
+			t.Errorf("run %d: scans = %d, found = %d, want 1 and %d", i, len(cl.offsets), len(found), want)
+		}
+	}
+}
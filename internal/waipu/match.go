@@ -0,0 +1,92 @@
+package waipu
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/gotd/td/telegram/query/messages"
+	"github.com/gotd/td/tg"
+)
+
+const (
+	prefixRegexp  = "re:"
+	prefixKeyword = "kw:"
+)
+
+// Matcher matches the message text.
+type Matcher struct {
+	spec     string
+	substr   string
+	keywords []string
+	re       *regexp.Regexp
+}
+
+// ParseMatcher parses the matcher specification, which can be one of:
+//
+//   - "re:EXPR" - Go regular expression EXPR;
+//   - "kw:WORD1,WORD2,..." - any of the keywords, case-insensitive;
+//   - anything else is a substring, case-sensitive.
+//
+// Empty specification returns nil matcher.
+func ParseMatcher(spec string) (*Matcher, error) {
+	if spec == "" {
+		return nil, nil
+	}
+	m := &Matcher{spec: spec}
+	switch {
+	case strings.HasPrefix(spec, prefixRegexp):
+		re, err := regexp.Compile(strings.TrimPrefix(spec, prefixRegexp))
+		if err != nil {
+			return nil, fmt.Errorf("invalid regular expression: %w", err)
+		}
+		m.re = re
+	case strings.HasPrefix(spec, prefixKeyword):
+		for _, kw := range strings.Split(strings.TrimPrefix(spec, prefixKeyword), ",") {
+			if kw = strings.TrimSpace(kw); kw != "" {
+				m.keywords = append(m.keywords, strings.ToLower(kw))
+			}
+		}
+		if len(m.keywords) == 0 {
+			return nil, fmt.Errorf("no keywords in %q", spec)
+		}
+	default:
+		m.substr = spec
+	}
+	return m, nil
+}
+
+// MatchString returns true if s matches.
+func (m *Matcher) MatchString(s string) bool {
+	switch {
+	case m.re != nil:
+		return m.re.MatchString(s)
+	case len(m.keywords) > 0:
+		s = strings.ToLower(s)
+		for _, kw := range m.keywords {
+			if strings.Contains(s, kw) {
+				return true
+			}
+		}
+		return false
+	default:
+		return strings.Contains(s, m.substr)
+	}
+}
+
+// String returns the matcher specification.
+func (m *Matcher) String() string {
+	if m == nil {
+		return ""
+	}
+	return m.spec
+}
+
+// msgText returns the text of the message, or the caption of the media.
+func msgText(m messages.Elem) string {
+	msg, ok := m.Msg.(*tg.Message)
+	if !ok {
+		return ""
+	}
+	return msg.Message
+}
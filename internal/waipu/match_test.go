@@ -0,0 +1,111 @@
+package waipu
+
+import (
+	"context"
+	"slices"
+	"testing"
+
+	"github.com/gotd/td/telegram/query/messages"
+	"github.com/gotd/td/tg"
+)
+
+func TestMatcher_MatchString(t *testing.T) {
+	tests := []struct {
+		spec string
+		s    string
+		want bool
+	}{
+		{"Project X", "about Project X today", true},
+		{"Project X", "about project x today", false},
+		{"kw:apollo, Gemini", "launching GEMINI soon", true},
+		{"kw:apollo,gemini", "nothing here", false},
+		{`re:\+?\d{3}[- ]?\d{3}[- ]?\d{4}`, "call me at 555-123-4567", true},
+		{`re:(?i)^hello`, "HELLO world", true},
+		{`re:^hello`, "say hello", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.spec, func(t *testing.T) {
+			m, err := ParseMatcher(tt.spec)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := m.MatchString(tt.s); got != tt.want {
+				t.Errorf("MatchString(%q) = %v, want %v", tt.s, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseMatcher_errors(t *testing.T) {
+	for _, spec := range []string{"re:(", "kw:,,"} {
+		if _, err := ParseMatcher(spec); err == nil {
+			t.Errorf("ParseMatcher(%q) expected an error", spec)
+		}
+	}
+	if m, err := ParseMatcher(""); m != nil || err != nil {
+		t.Errorf("ParseMatcher(\"\") = %v, %v, want nil, nil", m, err)
+	}
+}
+
+func TestFilter_content(t *testing.T) {
+	content, _ := ParseMatcher("kw:codename")
+	exclude, _ := ParseMatcher("keep")
+	f := Filter{Content: content, ExcludeContent: exclude}
+	for _, tt := range []struct {
+		text string
+		want bool
+	}{
+		{"the Codename is secret", true},
+		{"codename, but keep it", false},
+		{"unrelated", false},
+	} {
+		m := messages.Elem{Msg: &tg.Message{Message: tt.text}}
+		if got := f.Match(m); got != tt.want {
+			t.Errorf("Match(%q) = %v, want %v", tt.text, got, tt.want)
+		}
+	}
+}
+
+// TestWiper_contentRetention checks that the text filter is applied before
+// the retention in the text UI, that scans with Wiper.Scan, the same way as
+// in the batch mode.
+func TestWiper_contentRetention(t *testing.T) {
+	ft := newFakeTelegram()
+	for i, text := range []string{"codename 1", "other", "codename 2", "other", "codename 3"} {
+		m := testMsg(10+i, date("2020-01-01").AddDate(0, 0, i))
+		m.Msg.(*tg.Message).Message = text
+		ft.messages[1] = append(ft.messages[1], m)
+	}
+	ft.chats = append(ft.chats, &tg.Chat{ID: 1, Title: "one"})
+	content, _ := ParseMatcher("codename")
+	opts := []Option{
+		WithFilter(Filter{Content: content}),
+		WithRetention(Retention{KeepLast: 1}),
+	}
+
+	// the text UI: the filter is set, then the chat is scanned.
+	ui := NewWiper(ft, WithRetention(Retention{KeepLast: 1}))
+	f := ui.Filter()
+	f.Content = content
+	ui.SetFilter(f)
+	msgs, err := ui.Scan(context.Background(), ft.chats[0], nil)
+	if err != nil {
+		t.Fatalf("Scan() error = %v", err)
+	}
+	var scanned []int
+	for _, m := range msgs {
+		scanned = append(scanned, m.Msg.GetID())
+	}
+
+	if err := Batch(context.Background(), ft, targets(t, ft, "1"), opts...); err != nil {
+		t.Fatalf("Batch() error = %v", err)
+	}
+	// the last matching message (14) is kept.
+	want := []int{12, 10}
+	if !slices.Equal(scanned, want) {
+		t.Errorf("text UI found = %v, want %v", scanned, want)
+	}
+	if got := ft.deleted[1]; !slices.Equal(got, want) {
+		t.Errorf("batch deleted = %v, want %v", got, want)
+	}
+}
@@ -0,0 +1,286 @@
+package waipu
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/gotd/td/telegram/query/messages"
+	"github.com/rusq/dlog"
+	mtp "github.com/rusq/mtpwrap"
+)
+
+// pipelineDepth is the number of the message batches that the scan may get
+// ahead of the deletion.  Once the buffer is full, the scan waits for the
+// deletion to catch up.
+const pipelineDepth = 4
+
+// keeper applies the retention to the messages that come one by one, newest
+// first.  The result is the same as of Retention.Apply, as long as the
+// messages are in the order of their dates.
+type keeper struct {
+	r      Retention
+	cutoff time.Time
+	kept   int
+	// done is set on the first message that is not kept, all older
+	// messages are not kept either.
+	done bool
+}
+
+func newKeeper(r Retention, now time.Time) *keeper {
+	return &keeper{r: r, cutoff: now.Add(-r.KeepNewer)}
+}
+
+// keep returns true if the message m is kept by the retention.
+func (k *keeper) keep(m messages.Elem) bool {
+	if k.done {
+		return false
+	}
+	if k.kept < k.r.KeepLast || (k.r.KeepNewer > 0 && msgDate(m).After(k.cutoff)) {
+		k.kept++
+		return true
+	}
+	k.done = true
+	return false
+}
+
+// Wipe scans the chat and deletes the messages that satisfy the filter and
+// are not kept by the retention.  Unlike Scan and Delete, the messages are
+// deleted in batches while the scan continues, so only a few batches are
+// held in memory, see pipelineDepth.  Each batch is exported before it is
+// deleted, and is removed from the checkpoint, if the checkpoints are set,
+// so that the checkpoint holds only the messages that are kept or not yet
+// deleted.
+// It returns the number of messages found and deleted.  If the run limits
+// are reached, see WithLimits, the scan stops, the queued batches are
+// deleted, and ErrLimitReached is returned, the checkpoint is kept, and is
+// continued by the next run, unless it exports the messages, see
+// Checkpoint.Limited.  Wipe can not be used
+// in the dry-run and planning modes, as they need all messages at once.
+func (w *Wiper) Wipe(ctx context.Context, chat mtp.Entity, cb func(n int)) (found int, deleted int, err error) {
+	if w.IsProtected(chat) {
+		return 0, 0, ErrProtected
+	}
+	if !w.opts.deletes() {
+		return 0, 0, errors.New("messages are not deleted in the dry-run and planning modes")
+	}
+	id := chat.GetID()
+	minID := w.minID(id)
+	var cp Checkpoint
+	if w.checkpointed() {
+		if _, err := w.opts.checkpoints.start(id, w.criteria(), w.opts.resume, w.opts.exporter != nil); err != nil {
+			return 0, 0, fmt.Errorf("failed to save the checkpoint: %w", err)
+		}
+		cp, _ = w.opts.checkpoints.Get(id)
+		if cp.Offset > 0 || cp.Scanned {
+			dlog.Printf("chat %d: resuming, %d messages found, %d deleted", id, len(cp.Found), len(cp.Deleted))
+		}
+	}
+
+	ctx, cancel := context.WithCancelCause(ctx)
+	defer cancel(nil)
+	batches := make(chan []messages.Elem, pipelineDepth)
+	done := make(chan struct{})
+	var deleteErr error
+	go func() {
+		defer close(done)
+		for batch := range batches {
+			n, err := w.deleteBatch(ctx, chat, batch)
+			deleted += n
+			if err != nil {
+				deleteErr = err
+				cancel(err)
+				// the scan stops, the rest of the batches are dropped.
+				for range batches {
+				}
+				return
+			}
+		}
+	}()
+
+	var (
+		k     = newKeeper(w.opts.retention, time.Now())
+		batch []messages.Elem
+		// newest is the newest scanned message, and mark is the newest
+		// message to delete after the last kept one, see markOf.
+		newest = cp.Newest
+		mark   PlanMessage
+		kept   bool
+	)
+	// add adds the message that matches the filter to the batch, unless it
+	// is kept by the retention or is already deleted.  It returns
+	// ErrLimitReached, once the run limits are reached.  The full batch is
+	// queued for deletion by flush.
+	add := func(m messages.Elem, isDeleted bool) error {
+		if k.keep(m) {
+			kept, mark = true, PlanMessage{}
+			return nil
+		}
+		if mark.ID == 0 {
+			mark = planMessage(m)
+		}
+		if isDeleted {
+			return nil
+		}
+		if err := w.opts.budget.take(); err != nil {
+			return err
+		}
+		found++
+		batch = append(batch, m)
+		return nil
+	}
+	flush := func() {
+		if len(batch) == deleteChunk {
+			batches <- batch
+			batch = nil
+		}
+	}
+
+	// the messages found before the interruption go first, as they are
+	// newer than the rest of the chat.
+	isDeleted := make(map[int]bool, len(cp.Deleted))
+	for _, msgID := range cp.Deleted {
+		isDeleted[msgID] = true
+	}
+	var scanErr error
+	for _, pm := range cp.Found {
+		if scanErr = add(pm.elem(), isDeleted[pm.ID]); scanErr != nil {
+			break
+		}
+		flush()
+	}
+	// if the limit is reached before all found messages are queued, the
+	// checkpoint is left with the messages that have no contents.
+	replayed := scanErr == nil
+	// the deleted messages are not in the checkpoint, and the newest of
+	// them is the mark, see deleteBatch.
+	if cp.Mark.ID > mark.ID {
+		mark = cp.Mark
+	}
+	if !cp.Scanned && scanErr == nil {
+		scanErr = w.search(ctx, chat, cp.Offset, minID, cb, func(m messages.Elem) error {
+			if err := w.opts.budget.expired(); err != nil {
+				return err
+			}
+			if m.Msg.GetID() > newest.ID {
+				newest = planMessage(m)
+			}
+			match := w.opts.filter.Match(m)
+			if match {
+				// the message over the run limit is not recorded, so
+				// that the next run starts with it.
+				if err := add(m, false); err != nil {
+					return err
+				}
+			}
+			if w.checkpointed() {
+				if err := w.opts.checkpoints.update(id, false, func(cp *Checkpoint) {
+					cp.Newest = newest
+					if match {
+						cp.Found = append(cp.Found, planMessage(m))
+					}
+					cp.Offset = m.Msg.GetID()
+				}); err != nil {
+					return fmt.Errorf("failed to save the checkpoint: %w", err)
+				}
+			}
+			// the message is recorded before it is deleted, see
+			// deleteBatch.
+			flush()
+			return nil
+		})
+		if scanErr == nil && w.checkpointed() {
+			scanErr = w.opts.checkpoints.update(id, true, func(cp *Checkpoint) { cp.Scanned = true })
+		}
+	}
+	if len(batch) > 0 {
+		batches <- batch
+	}
+	close(batches)
+	<-done
+
+	err = scanErr
+	if deleteErr != nil {
+		// the scan was cancelled because of the deletion error.
+		err = deleteErr
+	}
+	// the batches deleted so far are saved, even if the wipe failed.
+	if ferr := w.finishExport(chat); ferr != nil && err == nil {
+		err = ferr
+	}
+	if err != nil {
+		if w.checkpointed() {
+			_ = w.opts.checkpoints.update(id, true, func(cp *Checkpoint) {
+				cp.Limited = replayed && errors.Is(err, ErrLimitReached)
+			})
+		}
+		return found, deleted, err
+	}
+	if w.checkpointed() {
+		if err := w.opts.checkpoints.remove(id); err != nil {
+			return found, deleted, fmt.Errorf("failed to save the checkpoint: %w", err)
+		}
+	}
+	if !kept {
+		mark = newest
+	}
+	w.setPending(id, mark)
+	if err := w.commitMark(id); err != nil {
+		return found, deleted, fmt.Errorf("failed to save the high-water mark: %w", err)
+	}
+	return found, deleted, nil
+}
+
+// deleteBatch exports and deletes the batch of messages, and removes them
+// from the checkpoint.  The batches are deleted newest first, so the newest
+// deleted message is recorded as the mark.
+func (w *Wiper) deleteBatch(ctx context.Context, chat mtp.Entity, batch []messages.Elem) (int, error) {
+	if err := w.exportBatch(ctx, chat, batch); err != nil {
+		return 0, fmt.Errorf("messages were not deleted: %w", err)
+	}
+	n, err := w.cl.DeleteMessages(ctx, chat, batch)
+	if err != nil || !w.checkpointed() {
+		return n, err
+	}
+	if err := w.opts.checkpoints.update(chat.GetID(), false, func(cp *Checkpoint) {
+		deleted := make(map[int]bool, len(batch))
+		for _, m := range batch {
+			deleted[m.Msg.GetID()] = true
+			if m.Msg.GetID() > cp.Mark.ID {
+				cp.Mark = planMessage(m)
+			}
+		}
+		cp.Found = slices.DeleteFunc(cp.Found, func(pm PlanMessage) bool { return deleted[pm.ID] })
+	}); err != nil {
+		return n, fmt.Errorf("failed to save the checkpoint: %w", err)
+	}
+	return n, nil
+}
+
+// exportBatch exports the batch of messages, if the exporter is set.  The
+// BatchExporter appends the batch to the export of the chat, other
+// exporters export it as is.
+func (w *Wiper) exportBatch(ctx context.Context, chat mtp.Entity, batch []messages.Elem) error {
+	be, ok := w.opts.exporter.(BatchExporter)
+	if !ok {
+		return w.export(ctx, chat, batch)
+	}
+	if err := be.Append(ctx, chat, batch); err != nil {
+		return fmt.Errorf("export failed: %w", err)
+	}
+	return nil
+}
+
+// finishExport completes the export of the chat, started by exportBatch.
+func (w *Wiper) finishExport(chat mtp.Entity) error {
+	be, ok := w.opts.exporter.(BatchExporter)
+	if !ok {
+		return nil
+	}
+	if err := be.Finish(chat); err != nil {
+		return fmt.Errorf("export failed: %w", err)
+	}
+	return nil
+}
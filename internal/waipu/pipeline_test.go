@@ -0,0 +1,175 @@
+package waipu
+
+import (
+	"context"
+	"errors"
+	"iter"
+	"path/filepath"
+	"slices"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/gotd/td/telegram/query/messages"
+	mtp "github.com/rusq/mtpwrap"
+)
+
+func TestKeeper(t *testing.T) {
+	now := date("2024-01-31")
+	// newest first.
+	msgs := []messages.Elem{
+		testMsg(4, date("2024-01-30")),
+		testMsg(3, date("2024-01-29")),
+		testMsg(2, date("2024-01-15")),
+		testMsg(1, date("2024-01-01")),
+	}
+	tests := []struct {
+		name string
+		r    Retention
+	}{
+		{"empty keeps nothing", Retention{}},
+		{"keep last 2", Retention{KeepLast: 2}},
+		{"keep more than there is", Retention{KeepLast: 10}},
+		{"keep newer than 10 days", Retention{KeepNewer: 10 * day}},
+		{"keep newer than 20 days", Retention{KeepNewer: 20 * day}},
+		{"keep last 1 or newer than 10 days", Retention{KeepLast: 1, KeepNewer: 10 * day}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			k := newKeeper(tt.r, now)
+			got := []int{}
+			for _, m := range msgs {
+				if !k.keep(m) {
+					got = append(got, m.Msg.GetID())
+				}
+			}
+			if want := ids(tt.r.Apply(msgs, now)); !slices.Equal(got, want) {
+				t.Errorf("not kept = %v, Apply() = %v", got, want)
+			}
+		})
+	}
+}
+
+// slowTelegram is the fake Telegram client, that counts the scanned
+// messages, and blocks the deletion until release is closed.
+type slowTelegram struct {
+	*fakeTelegram
+	scanned atomic.Int64
+	started chan struct{}
+	release chan struct{}
+	once    sync.Once
+}
+
+func (st *slowTelegram) IterMyMessages(ctx context.Context, dlg mtp.Entity, offsetID int, before time.Time) iter.Seq2[messages.Elem, error] {
+	return func(yield func(messages.Elem, error) bool) {
+		for m := range st.fakeTelegram.IterMyMessages(ctx, dlg, offsetID, before) {
+			st.scanned.Add(1)
+			if !yield(m, nil) {
+				return
+			}
+		}
+	}
+}
+
+func (st *slowTelegram) DeleteMessages(ctx context.Context, dlg mtp.Entity, msgs []messages.Elem) (int, error) {
+	st.once.Do(func() { close(st.started) })
+	<-st.release
+	return st.fakeTelegram.DeleteMessages(ctx, dlg, msgs)
+}
+
+func TestWiper_Wipe(t *testing.T) {
+	const total = 1000
+	ft := newFakeTelegram()
+	var msgs []messages.Elem
+	for id := 1; id <= total; id++ {
+		msgs = append(msgs, testMsg(id, date("2020-01-01").Add(time.Duration(id)*time.Minute)))
+	}
+	ft.addChat(1, "big", msgs...)
+	cl := &slowTelegram{fakeTelegram: ft, started: make(chan struct{}), release: make(chan struct{})}
+
+	type result struct {
+		found, deleted int
+		err            error
+	}
+	res := make(chan result, 1)
+	go func() {
+		var r result
+		r.found, r.deleted, r.err = NewWiper(cl).Wipe(context.Background(), ft.chats[0], nil)
+		res <- r
+	}()
+
+	// the deletion starts before the scan is complete, and the scan waits,
+	// once the buffer is full: one batch is being deleted, pipelineDepth
+	// batches are buffered, and one is being filled.
+	<-cl.started
+	time.Sleep(50 * time.Millisecond)
+	if n, limit := cl.scanned.Load(), int64((pipelineDepth+2)*deleteChunk); n > limit {
+		t.Errorf("scanned %d messages while the deletion is blocked, want at most %d", n, limit)
+	}
+	close(cl.release)
+
+	r := <-res
+	if r.err != nil || r.found != total || r.deleted != total {
+		t.Fatalf("Wipe() = %d, %d, %v, want %d, %d, nil", r.found, r.deleted, r.err, total, total)
+	}
+	if got := ft.deleted[1]; got[0] != total || got[len(got)-1] != 1 {
+		t.Errorf("deleted %v .. %v, want newest first", got[0], got[len(got)-1])
+	}
+}
+
+func TestWiper_WipeResume(t *testing.T) {
+	ft := newFakeTelegram()
+	var msgs []messages.Elem
+	for id := 1; id <= 250; id++ {
+		msgs = append(msgs, testMsg(id, date("2020-01-01").Add(time.Duration(id)*time.Minute)))
+	}
+	ft.addChat(1, "big", msgs...)
+	chat := ft.chats[0]
+	cps, err := OpenCheckpoints(filepath.Join(t.TempDir(), "checkpoints.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+	retention := WithRetention(Retention{KeepLast: 10})
+
+	// the second batch fails, and the scan is stopped.
+	cl := &flakyTelegram{fakeTelegram: ft, deleteFailAfter: deleteChunk}
+	found, deleted, err := NewWiper(cl, WithCheckpoints(cps, false), retention).Wipe(ctx, chat, nil)
+	if !errors.Is(err, errNetwork) || deleted != deleteChunk {
+		t.Fatalf("Wipe() = %d, %d, %v, want %d deleted and %v", found, deleted, err, deleteChunk, errNetwork)
+	}
+	// the deleted messages are removed from the checkpoint, only the newest
+	// of them is kept as the mark.
+	cp, ok := cps.Get(1)
+	if !ok || cp.Mark.ID != 240 {
+		t.Fatalf("checkpoint: %v, mark = %d, want 240", ok, cp.Mark.ID)
+	}
+	if i := slices.IndexFunc(cp.Found, func(pm PlanMessage) bool { return pm.ID > 140 && pm.ID <= 240 }); i >= 0 {
+		t.Errorf("the deleted message %d is in the checkpoint", cp.Found[i].ID)
+	}
+
+	marks, err := OpenMarks(filepath.Join(t.TempDir(), "marks.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	cl = &flakyTelegram{fakeTelegram: ft}
+	w := NewWiper(cl, WithCheckpoints(cps, true), WithMarks(marks, false), retention)
+	found, deleted, err = w.Wipe(ctx, chat, nil)
+	if err != nil || found != 140 || deleted != 140 {
+		t.Fatalf("resumed Wipe() = %d, %d, %v, want 140, 140, nil", found, deleted, err)
+	}
+	// the mark is the newest deleted message, that was deleted before the
+	// resume.
+	if m, ok := marks.Get(1, w.criteria()); !ok || m.MessageID != 240 {
+		t.Errorf("mark = %d, %v, want 240", m.MessageID, ok)
+	}
+	if _, ok := cps.Get(1); ok {
+		t.Error("the checkpoint was not removed after the chat was wiped")
+	}
+	got := slices.Clone(ft.deleted[1])
+	slices.Sort(got)
+	if want := ids(msgs[:240]); !slices.Equal(got, want) {
+		t.Errorf("deleted %d messages, want 1 .. 240 once", len(got))
+	}
+}
@@ -0,0 +1,258 @@
+package waipu
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"github.com/gotd/td/telegram/query/messages"
+	"github.com/gotd/td/tg"
+	"github.com/rusq/dlog"
+	mtp "github.com/rusq/mtpwrap"
+)
+
+const planVersion = 1
+
+var (
+	// ErrIdentity is returned if the plan was made under a different account
+	// or session.
+	ErrIdentity = errors.New("the plan was made under a different account or session")
+	// ErrPlanVersion is returned if the plan file version is not supported.
+	ErrPlanVersion = errors.New("unsupported plan version")
+)
+
+// Identity identifies the account and the session.
+type Identity struct {
+	// UserID is the ID of the authenticated user.
+	UserID int64 `json:"user_id"`
+	// Session is the fingerprint of the session authorization key.
+	Session string `json:"session"`
+}
+
+// Plan is the set of messages to be deleted.  The plan is made by Batch with
+// WithPlan option, it can be reviewed, and then applied with Apply.
+type Plan struct {
+	Version  int        `json:"version"`
+	Created  time.Time  `json:"created"`
+	Identity Identity   `json:"identity"`
+	Filter   string     `json:"filter,omitempty"`
+	Chats    []PlanChat `json:"chats"`
+}
+
+// PlanChat is the chat in the plan.
+type PlanChat struct {
+	ID    int64  `json:"id"`
+	Title string `json:"title"`
+	// Username is the public username of the chat, it's used to find the
+	// chat, if it's not in the chat list.
+	Username string `json:"username,omitempty"`
+	// Filter is the filter that selected the messages, if it differs from
+	// the filter of the plan, i.e. in the configuration rules.
+	Filter   string        `json:"filter,omitempty"`
+	Messages []PlanMessage `json:"messages"`
+}
+
+// PlanMessage is the message in the plan.
+type PlanMessage struct {
+	ID   int       `json:"id"`
+	Date time.Time `json:"date"`
+	Type Kind      `json:"type"`
+}
+
+// NewPlan creates an empty plan for the identity id.
+func NewPlan(id Identity) *Plan {
+	return &Plan{
+		Version:  planVersion,
+		Created:  time.Now(),
+		Identity: id,
+	}
+}
+
+// add adds the messages msgs in the chat, selected by the filter f, to the
+// plan.
+func (p *Plan) add(chat mtp.Entity, f Filter, msgs []messages.Elem) {
+	pc := PlanChat{
+		ID:       chat.GetID(),
+		Title:    chat.GetTitle(),
+		Messages: make([]PlanMessage, 0, len(msgs)),
+	}
+	pc.Username, _ = Username(chat)
+	if fs := f.String(); fs != p.Filter {
+		pc.Filter = fs
+	}
+	for _, m := range msgs {
+		pc.Messages = append(pc.Messages, PlanMessage{
+			ID:   m.Msg.GetID(),
+			Date: msgDate(m),
+			Type: KindOf(m),
+		})
+	}
+	p.Chats = append(p.Chats, pc)
+}
+
+// Count returns the total number of messages in the plan.
+func (p *Plan) Count() int {
+	var n int
+	for _, c := range p.Chats {
+		n += len(c.Messages)
+	}
+	return n
+}
+
+// Write writes the plan to w as JSON.
+func (p *Plan) Write(w io.Writer) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(p)
+}
+
+// Save saves the plan to the file.
+func (p *Plan) Save(filename string) error {
+	f, err := os.Create(filename)
+	if err != nil {
+		return err
+	}
+	if err := p.Write(f); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// ReadPlan reads the plan from r.
+func ReadPlan(r io.Reader) (*Plan, error) {
+	var p Plan
+	if err := json.NewDecoder(r).Decode(&p); err != nil {
+		return nil, fmt.Errorf("invalid plan: %w", err)
+	}
+	if p.Version != planVersion {
+		return nil, fmt.Errorf("%w: %d", ErrPlanVersion, p.Version)
+	}
+	return &p, nil
+}
+
+// LoadPlan loads the plan from the file.
+func LoadPlan(filename string) (*Plan, error) {
+	f, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return ReadPlan(f)
+}
+
+// Apply deletes the messages listed in the plan.  It refuses to run, if the
+// plan was made under a different identity.  The result of each chat is
+// added to the report, if it is set with WithReport, and the returned error
+// is the error of the report, see Report.Err.
+func Apply(ctx context.Context, cl Telegramer, p *Plan, id Identity, opts ...Option) error {
+	if p.Identity != id {
+		return ErrIdentity
+	}
+	w := NewWiper(cl, opts...)
+	rep := w.opts.report
+	if rep == nil {
+		rep = new(Report)
+	}
+	rep.Started = time.Now()
+	defer rep.finish()
+
+	chats, err := cl.GetChats(ctx)
+	if err != nil {
+		return err
+	}
+	for i, pc := range p.Chats {
+		if ctx.Err() != nil {
+			dlog.Printf("INTERRUPTED: %d chats were not processed", len(p.Chats)-i)
+			for _, pc := range p.Chats[i:] {
+				rep.add(pc.result(StatusInterrupted, 0, ctx.Err()))
+			}
+			break
+		}
+		chat, err := pc.find(ctx, cl, chats)
+		if err != nil {
+			dlog.Printf("SKIPPED: chat %d: %s", pc.ID, err)
+			rep.add(pc.result(StatusNotFound, 0, ErrChatNotFound))
+			continue
+		}
+		res := applyChat(ctx, w, chat, pc)
+		rep.add(res)
+		switch res.Status {
+		case StatusProtected:
+			dlog.Printf("SKIPPED: chat %d: chat is protected", res.ID)
+		case StatusFailed, StatusInterrupted:
+			dlog.Printf("SKIPPED: chat %d: error deleting messages %s", res.ID, res.Error)
+		default:
+			dlog.Printf("OK: chat: %d: messages deleted: %d", res.ID, res.Deleted)
+		}
+	}
+	return rep.Err()
+}
+
+// applyChat deletes the plan messages in the chat, and returns its result.
+func applyChat(ctx context.Context, w *Wiper, chat mtp.Entity, pc PlanChat) ChatResult {
+	started := time.Now()
+	n, err := w.Delete(ctx, chat, pc.elems())
+	var res ChatResult
+	switch {
+	case ctx.Err() != nil:
+		res = pc.result(StatusInterrupted, n, ctx.Err())
+	case errors.Is(err, ErrProtected):
+		res = pc.result(StatusProtected, n, nil)
+	case err != nil:
+		res = pc.result(StatusFailed, n, err)
+	default:
+		res = pc.result(StatusOK, n, nil)
+	}
+	res.Title = chat.GetTitle()
+	res.Started, res.Finished = started, time.Now()
+	return res
+}
+
+// result returns the result of applying the plan chat with the status, the
+// number of deleted messages n and the error err, if not nil.
+func (pc PlanChat) result(status Status, n int, err error) ChatResult {
+	res := ChatResult{
+		ID:      pc.ID,
+		Title:   pc.Title,
+		Status:  status,
+		Found:   len(pc.Messages),
+		Deleted: n,
+	}
+	if err != nil {
+		res.Error = err.Error()
+		res.Err = err
+	}
+	return res
+}
+
+// find returns the plan chat from the chat list, or resolves it by the
+// username.
+func (pc PlanChat) find(ctx context.Context, cl Telegramer, chats []mtp.Entity) (mtp.Entity, error) {
+	idx, err := findIdxOf(chats, pc.ID)
+	if err == nil {
+		return chats[idx], nil
+	}
+	if pc.Username == "" {
+		return nil, err
+	}
+	chat, rerr := resolveUsername(ctx, cl, pc.Username)
+	if rerr != nil || chat.GetID() != pc.ID {
+		return nil, err
+	}
+	return chat, nil
+}
+
+// elems returns the plan messages as message elements, suitable for
+// deletion.
+func (pc PlanChat) elems() []messages.Elem {
+	ret := make([]messages.Elem, len(pc.Messages))
+	for i, m := range pc.Messages {
+		ret[i] = messages.Elem{Msg: &tg.Message{ID: m.ID, Date: int(m.Date.Unix())}}
+	}
+	return ret
+}
@@ -0,0 +1,85 @@
+package waipu
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"slices"
+	"testing"
+)
+
+func TestPlanApply(t *testing.T) {
+	ft := newFakeTelegram()
+	ft.addChat(1, "one",
+		testMsg(10, date("2020-01-01")),
+		testMsg(11, date("2021-01-01")),
+	)
+	ft.addChat(2, "two", testMsg(20, date("2020-01-01")))
+
+	id := Identity{UserID: 42, Session: "0123456789abcdef"}
+	plan := NewPlan(id)
+	if err := Batch(context.Background(), ft, targets(t, ft, "1", "2"), WithPlan(plan), WithFilter(Filter{Before: date("2020-06-01")})); err != nil {
+		t.Fatalf("Batch() error = %v", err)
+	}
+	if len(ft.deleted) != 0 {
+		t.Fatalf("planning deleted messages: %v", ft.deleted)
+	}
+	if plan.Count() != 2 {
+		t.Errorf("plan.Count() = %d, want 2", plan.Count())
+	}
+
+	var buf bytes.Buffer
+	if err := plan.Write(&buf); err != nil {
+		t.Fatalf("Write() error = %v", err)
+	}
+	loaded, err := ReadPlan(&buf)
+	if err != nil {
+		t.Fatalf("ReadPlan() error = %v", err)
+	}
+
+	other := Identity{UserID: 42, Session: "fedcba9876543210"}
+	if err := Apply(context.Background(), ft, loaded, other); !errors.Is(err, ErrIdentity) {
+		t.Errorf("Apply() with different session error = %v, want %v", err, ErrIdentity)
+	}
+	if len(ft.deleted) != 0 {
+		t.Fatalf("refused plan deleted messages: %v", ft.deleted)
+	}
+
+	if err := Apply(context.Background(), ft, loaded, id); err != nil {
+		t.Fatalf("Apply() error = %v", err)
+	}
+	if got := ft.deleted[1]; !slices.Equal(got, []int{10}) {
+		t.Errorf("chat 1 deleted = %v, want [10]", got)
+	}
+	if got := ft.deleted[2]; !slices.Equal(got, []int{20}) {
+		t.Errorf("chat 2 deleted = %v, want [20]", got)
+	}
+}
+
+func TestApply_report(t *testing.T) {
+	ft := newFakeTelegram()
+	ft.addChat(1, "one", testMsg(10, date("2020-01-01")))
+	id := Identity{UserID: 42, Session: "0123456789abcdef"}
+	plan := NewPlan(id)
+	plan.Chats = []PlanChat{
+		{ID: 1, Title: "one", Messages: []PlanMessage{{ID: 10}}},
+		{ID: 2, Title: "gone", Messages: []PlanMessage{{ID: 20}, {ID: 21}}},
+	}
+	var rep Report
+	err := Apply(context.Background(), ft, plan, id, WithReport(&rep))
+	if !errors.Is(err, ErrChatNotFound) {
+		t.Errorf("Apply() error = %v, want %v", err, ErrChatNotFound)
+	}
+	if len(rep.Chats) != 2 {
+		t.Fatalf("report chats = %d, want 2", len(rep.Chats))
+	}
+	if got := rep.Chats[0]; got.Status != StatusOK || got.Deleted != 1 {
+		t.Errorf("chat 1 result = %+v", got)
+	}
+	if got := rep.Chats[1]; got.Status != StatusNotFound || got.ID != 2 || got.Found != 2 {
+		t.Errorf("chat 2 result = %+v", got)
+	}
+	if rep.Error == "" {
+		t.Error("report error is not set")
+	}
+}
@@ -0,0 +1,184 @@
+package waipu
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"slices"
+	"strconv"
+	"sync"
+	"text/tabwriter"
+	"time"
+
+	mtp "github.com/rusq/mtpwrap"
+)
+
+// ErrProtected is returned on the attempt to scan or delete the messages in
+// the protected chat.
+var ErrProtected = errors.New("chat is protected")
+
+// ProtectedChat is the chat in the protected list.
+type ProtectedChat struct {
+	ID    int64     `json:"id"`
+	Title string    `json:"title"`
+	Added time.Time `json:"added"`
+}
+
+// Protected is the persistent list of the protected chats.  The messages in
+// the protected chats are never deleted.  The list is saved on every change.
+type Protected struct {
+	mu       sync.RWMutex
+	filename string
+	chats    []ProtectedChat
+}
+
+// OpenProtected opens the protected chats file.  If the file does not
+// exist, the list is empty, and the file is created on the first change.
+func OpenProtected(filename string) (*Protected, error) {
+	p := &Protected{filename: filename}
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return p, nil
+		}
+		return nil, err
+	}
+	if err := json.Unmarshal(data, &p.chats); err != nil {
+		return nil, fmt.Errorf("invalid protected chats file %s: %w", filename, err)
+	}
+	return p, nil
+}
+
+// WithProtected sets the protected chats list.  The wiper refuses to scan
+// and delete the messages in the protected chats.
+func WithProtected(p *Protected) Option {
+	return func(o *options) {
+		o.protected = p
+	}
+}
+
+// Contains returns true if the chat with id is protected.  Nil list has no
+// chats.
+func (p *Protected) Contains(id int64) bool {
+	if p == nil {
+		return false
+	}
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	return slices.ContainsFunc(p.chats, func(c ProtectedChat) bool { return c.ID == id })
+}
+
+// Chats returns the protected chats.
+func (p *Protected) Chats() []ProtectedChat {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	return slices.Clone(p.chats)
+}
+
+// Add adds the chats to the list, and returns the number of the chats
+// added, the chats that are already protected are skipped.
+func (p *Protected) Add(chats ...mtp.Entity) (int, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	n := 0
+	for _, chat := range chats {
+		if slices.ContainsFunc(p.chats, func(c ProtectedChat) bool { return c.ID == chat.GetID() }) {
+			continue
+		}
+		p.chats = append(p.chats, ProtectedChat{ID: chat.GetID(), Title: chat.GetTitle(), Added: time.Now()})
+		n++
+	}
+	if n == 0 {
+		return 0, nil
+	}
+	return n, p.save()
+}
+
+// Remove removes the chats with ids from the list, and returns the number
+// of the chats removed.
+func (p *Protected) Remove(ids ...int64) (int, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	before := len(p.chats)
+	p.chats = slices.DeleteFunc(p.chats, func(c ProtectedChat) bool { return slices.Contains(ids, c.ID) })
+	n := before - len(p.chats)
+	if n == 0 {
+		return 0, nil
+	}
+	return n, p.save()
+}
+
+// save writes the list to the file.  It must be called with the mutex
+// held.
+func (p *Protected) save() error {
+	data, err := json.MarshalIndent(p.chats, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp := p.filename + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, p.filename)
+}
+
+// Protect adds the chats selected by sel to the protected list, and writes
+// the list to w.
+func Protect(ctx context.Context, w io.Writer, cl Telegramer, p *Protected, sel Selector) error {
+	t, err := ResolveTargets(ctx, cl, sel)
+	if err != nil {
+		return err
+	}
+	for _, spec := range t.Missing {
+		fmt.Fprintf(w, "chat %s: not found\n", spec)
+	}
+	n, err := p.Add(t.Chats...)
+	if err != nil {
+		return fmt.Errorf("failed to save the protected chats: %w", err)
+	}
+	fmt.Fprintf(w, "%d chats protected\n", n)
+	return PrintProtected(w, p)
+}
+
+// Unprotect removes the chats selected by sel from the protected list, and
+// writes the list to w.  Chat IDs are removed even if the chat is no longer
+// available.
+func Unprotect(ctx context.Context, w io.Writer, cl Telegramer, p *Protected, sel Selector) error {
+	t, err := ResolveTargets(ctx, cl, sel)
+	if err != nil {
+		return err
+	}
+	var ids []int64
+	for _, chat := range t.Chats {
+		ids = append(ids, chat.GetID())
+	}
+	for _, spec := range t.Missing {
+		if id, err := strconv.ParseInt(spec, 10, 64); err == nil {
+			ids = append(ids, id)
+		}
+	}
+	n, err := p.Remove(ids...)
+	if err != nil {
+		return fmt.Errorf("failed to save the protected chats: %w", err)
+	}
+	fmt.Fprintf(w, "%d chats unprotected\n", n)
+	return PrintProtected(w, p)
+}
+
+// PrintProtected writes the protected chats to w.
+func PrintProtected(w io.Writer, p *Protected) error {
+	chats := p.Chats()
+	if len(chats) == 0 {
+		_, err := fmt.Fprintln(w, "no protected chats")
+		return err
+	}
+	tw := tabwriter.NewWriter(w, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(tw, "ID\tTITLE\tPROTECTED ON")
+	for _, c := range chats {
+		fmt.Fprintf(tw, "%d\t%s\t%s\n", c.ID, c.Title, c.Added.Format(time.DateOnly))
+	}
+	return tw.Flush()
+}
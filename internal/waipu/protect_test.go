@@ -0,0 +1,107 @@
+package waipu
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"path/filepath"
+	"testing"
+
+	"github.com/gotd/td/tg"
+	mtp "github.com/rusq/mtpwrap"
+)
+
+// newProtected returns the protected list in the temporary directory with
+// the chats.
+func newProtected(t *testing.T, chats ...mtp.Entity) *Protected {
+	t.Helper()
+	p, err := OpenProtected(filepath.Join(t.TempDir(), "protected.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := p.Add(chats...); err != nil {
+		t.Fatal(err)
+	}
+	return p
+}
+
+func TestProtected(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "protected.json")
+	p, err := OpenProtected(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p.Contains(1) {
+		t.Error("empty list contains chat 1")
+	}
+	if n, err := p.Add(&tg.Chat{ID: 1, Title: "one"}, &tg.Chat{ID: 2, Title: "two"}, &tg.Chat{ID: 1, Title: "one"}); err != nil || n != 2 {
+		t.Fatalf("Add() = %d, %v, want 2", n, err)
+	}
+
+	// the list survives the restart.
+	p, err = OpenProtected(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !p.Contains(1) || !p.Contains(2) {
+		t.Errorf("protected chats = %v", p.Chats())
+	}
+	if n, err := p.Remove(2, 3); err != nil || n != 1 {
+		t.Fatalf("Remove() = %d, %v, want 1", n, err)
+	}
+	if p, err = OpenProtected(filename); err != nil {
+		t.Fatal(err)
+	}
+	if !p.Contains(1) || p.Contains(2) {
+		t.Errorf("protected chats = %v", p.Chats())
+	}
+
+	var nilList *Protected
+	if nilList.Contains(1) {
+		t.Error("nil list contains chat 1")
+	}
+}
+
+func TestBatch_protected(t *testing.T) {
+	ft := newFakeTelegram()
+	ft.addChat(1, "one", testMsg(10, date("2020-01-01")))
+	ft.addChat(2, "family", testMsg(20, date("2020-01-01")))
+	protected := newProtected(t, ft.chats[1])
+
+	var rep Report
+	if err := Batch(context.Background(), ft, targets(t, ft, "all"), WithProtected(protected), WithReport(&rep)); err != nil {
+		t.Fatalf("Batch() error = %v", err)
+	}
+	if len(ft.deleted[2]) != 0 {
+		t.Errorf("messages deleted in the protected chat: %v", ft.deleted[2])
+	}
+	if len(ft.deleted[1]) != 1 {
+		t.Errorf("chat 1 deleted = %v", ft.deleted[1])
+	}
+	if got := rep.Chats[1].Status; got != StatusProtected {
+		t.Errorf("chat 2 status = %s, want %s", got, StatusProtected)
+	}
+
+	// every deletion path goes through the wiper.
+	w := NewWiper(ft, WithProtected(protected))
+	if _, err := w.Delete(context.Background(), ft.chats[1], ft.messages[2]); !errors.Is(err, ErrProtected) {
+		t.Errorf("Delete() error = %v, want %v", err, ErrProtected)
+	}
+	if _, err := w.Scan(context.Background(), ft.chats[1], nil); !errors.Is(err, ErrProtected) {
+		t.Errorf("Scan() error = %v, want %v", err, ErrProtected)
+	}
+}
+
+func TestUnprotect(t *testing.T) {
+	ft := newFakeTelegram()
+	ft.addChat(1, "one")
+	// chat 2 is no longer available.
+	protected := newProtected(t, ft.chats[0], &tg.Chat{ID: 2, Title: "gone"}, &tg.Chat{ID: 3, Title: "three"})
+	var buf bytes.Buffer
+	if err := Unprotect(context.Background(), &buf, ft, protected, mustSelector(t, "title:one", "2")); err != nil {
+		t.Fatal(err)
+	}
+	if protected.Contains(1) || protected.Contains(2) || !protected.Contains(3) {
+		t.Errorf("protected chats = %v", protected.Chats())
+	}
+}
@@ -0,0 +1,436 @@
+package waipu
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"iter"
+	"os"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/gotd/td/telegram/query/messages"
+	"github.com/gotd/td/tg"
+	"github.com/gotd/td/tgerr"
+	"github.com/rusq/dlog"
+	mtp "github.com/rusq/mtpwrap"
+)
+
+const (
+	// pacingStep is the interval between the requests after the first flood
+	// wait, it is doubled on each next one, up to maxPacing.
+	pacingStep = 250 * time.Millisecond
+	maxPacing  = 30 * time.Second
+	// relaxAfter is the number of the successful requests, after which the
+	// interval between the requests is halved.
+	relaxAfter = 20
+	// longWait is the flood wait that is saved to the file, so that the next
+	// run waits out the rest of it, instead of getting the new penalty.
+	longWait = time.Minute
+	// floodRetries is the number of the flood waits in a row, after which
+	// the request fails.
+	floodRetries = 10
+)
+
+// WaitFunc is called every second while the requests wait for the flood
+// wait to end, with the time left, and with zero, once the wait is over.
+type WaitFunc func(left time.Duration)
+
+type waitFuncKey struct{}
+
+// NotifyWait returns the context, that makes the Limiter call fn, while the
+// requests made with this context are waiting for the flood wait to end.
+func NotifyWait(ctx context.Context, fn WaitFunc) context.Context {
+	return context.WithValue(ctx, waitFuncKey{}, fn)
+}
+
+// Limiter is the rate limit controller for the Telegram requests.  It waits
+// out the FLOOD_WAIT errors and retries the requests, and slows down the
+// requests after each flood wait, speeding them up again, while they
+// succeed.  The long flood waits are saved to the file, and the next run
+// waits until the wait is over, before making any requests.
+type Limiter struct {
+	mu       sync.Mutex
+	filename string
+	// until is the end of the flood wait.
+	until time.Time
+	// interval is the current minimum interval between the requests, and
+	// last is the time of the last request.
+	interval time.Duration
+	last     time.Time
+	ok       int
+}
+
+type limiterState struct {
+	Until time.Time `json:"until"`
+}
+
+// OpenLimiter creates the limiter, that saves the long flood waits to the
+// file.  If the file has the flood wait that is not over yet, the requests
+// wait until it ends.  Empty filename disables saving.
+func OpenLimiter(filename string) (*Limiter, error) {
+	l := &Limiter{filename: filename}
+	if filename == "" {
+		return l, nil
+	}
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return l, nil
+		}
+		return nil, err
+	}
+	var st limiterState
+	if err := json.Unmarshal(data, &st); err != nil {
+		return nil, fmt.Errorf("invalid flood wait file %s: %w", filename, err)
+	}
+	if left := time.Until(st.Until); left > 0 {
+		dlog.Printf("the previous run was rate limited by Telegram, waiting %s before making the requests", left.Round(time.Second))
+		l.until = st.Until
+	}
+	return l, nil
+}
+
+// WithLimiter makes the wiper requests go through the rate limit controller
+// l.  The same controller should be shared by all wipers of the run.
+func WithLimiter(l *Limiter) Option {
+	return func(o *options) {
+		o.limiter = l
+	}
+}
+
+// Wrap returns the Telegram client, that makes the requests through the
+// limiter.  If cl implements all optional interfaces, i.e. MessageCounter,
+// UsernameResolver, FolderLister and ArchiveLister, as tgclient.Client does,
+// the returned client implements them too.  The client that is already
+// wrapped by l is returned as is.
+func (l *Limiter) Wrap(cl Telegramer) Telegramer {
+	switch c := cl.(type) {
+	case *limitedFullClient:
+		if c.l == l {
+			return cl
+		}
+	case *limitedClient:
+		if c.l == l {
+			return cl
+		}
+	}
+	lc := &limitedClient{cl: cl, l: l}
+	if fc, ok := cl.(fullClient); ok {
+		return &limitedFullClient{limitedClient: lc, fc: fc}
+	}
+	return lc
+}
+
+// WrapAutoDeleter returns the auto-delete client, that makes the requests
+// through the limiter.  If cl is a FolderLister and a UsernameResolver, as
+// tgclient.Client is, the returned client is too.
+func (l *Limiter) WrapAutoDeleter(cl AutoDeleter) AutoDeleter {
+	la := &limitedAutoDeleter{cl: cl, l: l}
+	if r, ok := cl.(resolver); ok {
+		return &limitedResolvingAutoDeleter{limitedAutoDeleter: la, r: r}
+	}
+	return la
+}
+
+// do calls fn, once the limiter allows, and retries it on the flood wait.
+func (l *Limiter) do(ctx context.Context, fn func() error) error {
+	for retries := 0; ; retries++ {
+		if err := l.wait(ctx); err != nil {
+			return err
+		}
+		err := fn()
+		if !l.handle(err) || retries == floodRetries {
+			return err
+		}
+	}
+}
+
+// wait waits for the flood wait to end and for the interval since the
+// previous request to pass.
+func (l *Limiter) wait(ctx context.Context) error {
+	l.mu.Lock()
+	now := time.Now()
+	next := l.last.Add(l.interval)
+	flood := l.until.After(next)
+	if flood {
+		next = l.until
+	}
+	// the slot is reserved, so that the concurrent requests are paced too.
+	l.last = now
+	if next.After(now) {
+		l.last = next
+	}
+	l.mu.Unlock()
+
+	if !next.After(now) {
+		return nil
+	}
+	fn, _ := ctx.Value(waitFuncKey{}).(WaitFunc)
+	if !flood || fn == nil {
+		t := time.NewTimer(next.Sub(now))
+		defer t.Stop()
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-t.C:
+			return nil
+		}
+	}
+	defer fn(0)
+	tick := time.NewTicker(time.Second)
+	defer tick.Stop()
+	for left := time.Until(next); left > 0; left = time.Until(next) {
+		fn(left.Round(time.Second))
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-tick.C:
+		}
+	}
+	return nil
+}
+
+// handle adapts the pacing to the result of the request.  It returns true,
+// if the request was rate limited and should be retried.  Only the
+// successful requests speed the requests up.
+func (l *Limiter) handle(err error) bool {
+	d, ok := tgerr.AsFloodWait(err)
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if !ok {
+		if err != nil {
+			return false
+		}
+		if l.ok++; l.ok >= relaxAfter && l.interval > 0 {
+			l.ok = 0
+			if l.interval /= 2; l.interval < pacingStep {
+				l.interval = 0
+			}
+			dlog.Debugf("rate limit: the interval between the requests is %s", l.interval)
+		}
+		return false
+	}
+	if d == 0 {
+		d = time.Second
+	}
+	l.ok = 0
+	l.interval = min(max(2*l.interval, pacingStep), maxPacing)
+	if until := time.Now().Add(d); until.After(l.until) {
+		l.until = until
+	}
+	dlog.Printf("rate limited by Telegram, waiting %s, the interval between the requests is %s", d, l.interval)
+	if d >= longWait && l.filename != "" {
+		if err := l.save(); err != nil {
+			dlog.Printf("failed to save the flood wait: %s", err)
+		}
+	}
+	return true
+}
+
+// save writes the end of the flood wait to the file.  It must be called with
+// the mutex held.
+func (l *Limiter) save() error {
+	data, err := json.Marshal(limiterState{Until: l.until})
+	if err != nil {
+		return err
+	}
+	tmp := l.filename + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, l.filename)
+}
+
+// limitedClient is the Telegram client, that makes the requests through the
+// limiter.
+type limitedClient struct {
+	cl Telegramer
+	l  *Limiter
+}
+
+func (c *limitedClient) GetChats(ctx context.Context) ([]mtp.Entity, error) {
+	var chats []mtp.Entity
+	err := c.l.do(ctx, func() (err error) {
+		chats, err = c.cl.GetChats(ctx)
+		return err
+	})
+	return chats, err
+}
+
+// DeleteMessages deletes the messages in chunks, each chunk is a separate
+// request.  If the chunk is rate limited, only the chunks that are left are
+// retried, so that the deleted messages are not counted twice.
+func (c *limitedClient) DeleteMessages(ctx context.Context, dlg mtp.Entity, msgs []messages.Elem) (int, error) {
+	total := 0
+	for chunk := range slices.Chunk(msgs, deleteChunk) {
+		var n int
+		err := c.l.do(ctx, func() (err error) {
+			n, err = c.cl.DeleteMessages(ctx, dlg, chunk)
+			return err
+		})
+		total += n
+		if err != nil {
+			return total, err
+		}
+	}
+	return total, nil
+}
+
+// IterMyMessages iterates over the messages.  If the client is the
+// PagedIterator, each page request is paced and retried by the limiter.
+// Otherwise, the iteration is paced as one request, and, if it is rate
+// limited, it waits, and continues after the last message.
+func (c *limitedClient) IterMyMessages(ctx context.Context, dlg mtp.Entity, offsetID int, before time.Time) iter.Seq2[messages.Elem, error] {
+	if pi, ok := c.cl.(PagedIterator); ok {
+		return pi.IterMyMessagesPaged(ctx, dlg, offsetID, before, c.l.do)
+	}
+	return func(yield func(messages.Elem, error) bool) {
+		retries := 0
+		for {
+			if err := c.l.wait(ctx); err != nil {
+				yield(messages.Elem{}, err)
+				return
+			}
+			var flood bool
+			for m, err := range c.cl.IterMyMessages(ctx, dlg, offsetID, before) {
+				if err != nil {
+					if flood = c.l.handle(err); !flood || retries == floodRetries {
+						yield(messages.Elem{}, err)
+						return
+					}
+					break
+				}
+				// the flood waits in a row are counted.
+				retries = 0
+				offsetID = m.Msg.GetID()
+				if !yield(m, nil) {
+					return
+				}
+			}
+			if !flood {
+				c.l.handle(nil)
+				return
+			}
+			retries++
+		}
+	}
+}
+
+// fullClient is the Telegram client that implements all optional
+// interfaces.
+type fullClient interface {
+	Telegramer
+	MessageCounter
+	UsernameResolver
+	FolderLister
+	ArchiveLister
+}
+
+// limitedFullClient is the limitedClient, that implements the optional
+// interfaces of the wrapped client.
+type limitedFullClient struct {
+	*limitedClient
+	fc fullClient
+}
+
+func (c *limitedFullClient) CountMyMessages(ctx context.Context, chat mtp.Entity) (int, error) {
+	var n int
+	err := c.l.do(ctx, func() (err error) {
+		n, err = c.fc.CountMyMessages(ctx, chat)
+		return err
+	})
+	return n, err
+}
+
+func (c *limitedFullClient) ResolveUsername(ctx context.Context, username string) (mtp.Entity, error) {
+	var chat mtp.Entity
+	err := c.l.do(ctx, func() (err error) {
+		chat, err = c.fc.ResolveUsername(ctx, username)
+		return err
+	})
+	return chat, err
+}
+
+func (c *limitedFullClient) DialogFilters(ctx context.Context) ([]tg.DialogFilterClass, error) {
+	var filters []tg.DialogFilterClass
+	err := c.l.do(ctx, func() (err error) {
+		filters, err = c.fc.DialogFilters(ctx)
+		return err
+	})
+	return filters, err
+}
+
+func (c *limitedFullClient) ArchivedChats(ctx context.Context) ([]int64, error) {
+	var ids []int64
+	err := c.l.do(ctx, func() (err error) {
+		ids, err = c.fc.ArchivedChats(ctx)
+		return err
+	})
+	return ids, err
+}
+
+// limitedAutoDeleter is the auto-delete client, that makes the requests
+// through the limiter.
+type limitedAutoDeleter struct {
+	cl AutoDeleter
+	l  *Limiter
+}
+
+func (c *limitedAutoDeleter) GetDialogs(ctx context.Context) ([]mtp.Entity, error) {
+	var chats []mtp.Entity
+	err := c.l.do(ctx, func() (err error) {
+		chats, err = c.cl.GetDialogs(ctx)
+		return err
+	})
+	return chats, err
+}
+
+func (c *limitedAutoDeleter) HistoryTTL(ctx context.Context, chat mtp.Entity) (time.Duration, error) {
+	var d time.Duration
+	err := c.l.do(ctx, func() (err error) {
+		d, err = c.cl.HistoryTTL(ctx, chat)
+		return err
+	})
+	return d, err
+}
+
+func (c *limitedAutoDeleter) SetHistoryTTL(ctx context.Context, chat mtp.Entity, period time.Duration) error {
+	return c.l.do(ctx, func() error {
+		return c.cl.SetHistoryTTL(ctx, chat, period)
+	})
+}
+
+// resolver is the client, that can list the folders and resolve the
+// usernames, see resolveTargets.
+type resolver interface {
+	FolderLister
+	UsernameResolver
+}
+
+// limitedResolvingAutoDeleter is the limitedAutoDeleter, that lists the
+// folders and resolves the usernames through the limiter.
+type limitedResolvingAutoDeleter struct {
+	*limitedAutoDeleter
+	r resolver
+}
+
+func (c *limitedResolvingAutoDeleter) DialogFilters(ctx context.Context) ([]tg.DialogFilterClass, error) {
+	var filters []tg.DialogFilterClass
+	err := c.l.do(ctx, func() (err error) {
+		filters, err = c.r.DialogFilters(ctx)
+		return err
+	})
+	return filters, err
+}
+
+func (c *limitedResolvingAutoDeleter) ResolveUsername(ctx context.Context, username string) (mtp.Entity, error) {
+	var chat mtp.Entity
+	err := c.l.do(ctx, func() (err error) {
+		chat, err = c.r.ResolveUsername(ctx, username)
+		return err
+	})
+	return chat, err
+}
@@ -0,0 +1,264 @@
+package waipu
+
+import (
+	"context"
+	"errors"
+	"iter"
+	"path/filepath"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gotd/td/telegram/query/messages"
+	"github.com/gotd/td/tgerr"
+	mtp "github.com/rusq/mtpwrap"
+)
+
+// floodTelegram is the fake Telegram client, that returns the flood wait on
+// the floodCall-th deletion, the first one if zero, and after floodAfter
+// messages of the first scan.
+type floodTelegram struct {
+	*fakeTelegram
+	floodAfter int
+	floodCall  int
+
+	mu      sync.Mutex
+	offsets []int
+	calls   int
+}
+
+func (ft *floodTelegram) IterMyMessages(ctx context.Context, dlg mtp.Entity, offsetID int, before time.Time) iter.Seq2[messages.Elem, error] {
+	ft.mu.Lock()
+	ft.offsets = append(ft.offsets, offsetID)
+	first := len(ft.offsets) == 1
+	ft.mu.Unlock()
+	return func(yield func(messages.Elem, error) bool) {
+		n := 0
+		for m := range ft.fakeTelegram.IterMyMessages(ctx, dlg, offsetID, before) {
+			if first && n == ft.floodAfter {
+				yield(messages.Elem{}, tgerr.New(420, "FLOOD_WAIT_0"))
+				return
+			}
+			n++
+			if !yield(m, nil) {
+				return
+			}
+		}
+	}
+}
+
+func (ft *floodTelegram) DeleteMessages(ctx context.Context, dlg mtp.Entity, msgs []messages.Elem) (int, error) {
+	ft.mu.Lock()
+	ft.calls++
+	flood := ft.calls == max(ft.floodCall, 1)
+	ft.mu.Unlock()
+	if flood {
+		return 0, tgerr.New(420, "FLOOD_WAIT_0")
+	}
+	return ft.fakeTelegram.DeleteMessages(ctx, dlg, msgs)
+}
+
+func TestLimiter(t *testing.T) {
+	ft := newFakeTelegram()
+	ft.addChat(1, "one", testMsg(1, date("2020-01-01")), testMsg(2, date("2020-01-02")), testMsg(3, date("2020-01-03")))
+	chat := ft.chats[0]
+
+	t.Run("delete", func(t *testing.T) {
+		t.Parallel()
+		l, _ := OpenLimiter("")
+		cl := &floodTelegram{fakeTelegram: ft}
+		var waits []time.Duration
+		ctx := NotifyWait(context.Background(), func(left time.Duration) { waits = append(waits, left) })
+		n, err := l.Wrap(cl).DeleteMessages(ctx, chat, ft.messages[1])
+		if err != nil || n != 3 {
+			t.Fatalf("DeleteMessages() = %d, %v, want 3, nil", n, err)
+		}
+		if cl.calls != 2 {
+			t.Errorf("calls = %d, want 2", cl.calls)
+		}
+		if len(waits) < 2 || waits[0] != time.Second || waits[len(waits)-1] != 0 {
+			t.Errorf("countdown = %v, want 1s .. 0s", waits)
+		}
+		if l.interval != pacingStep {
+			t.Errorf("interval = %s, want %s", l.interval, pacingStep)
+		}
+	})
+	t.Run("scan", func(t *testing.T) {
+		t.Parallel()
+		l, _ := OpenLimiter("")
+		cl := &floodTelegram{fakeTelegram: ft, floodAfter: 2}
+		var got []int
+		for m, err := range l.Wrap(cl).IterMyMessages(context.Background(), chat, 0, time.Time{}) {
+			if err != nil {
+				t.Fatal(err)
+			}
+			got = append(got, m.Msg.GetID())
+		}
+		if !slices.Equal(got, []int{3, 2, 1}) {
+			t.Errorf("messages = %v, want [3 2 1]", got)
+		}
+		// the scan continues after the last message.
+		if !slices.Equal(cl.offsets, []int{0, 2}) {
+			t.Errorf("offsets = %v, want [0 2]", cl.offsets)
+		}
+	})
+	t.Run("delete chunks", func(t *testing.T) {
+		t.Parallel()
+		ft := newFakeTelegram()
+		var msgs []messages.Elem
+		for id := 1; id <= 250; id++ {
+			msgs = append(msgs, testMsg(id, date("2020-01-01")))
+		}
+		ft.addChat(1, "big", msgs...)
+		l, _ := OpenLimiter("")
+		// the second chunk is rate limited.
+		cl := &floodTelegram{fakeTelegram: ft, floodCall: 2}
+		n, err := l.Wrap(cl).DeleteMessages(context.Background(), ft.chats[0], msgs)
+		if err != nil || n != 250 {
+			t.Fatalf("DeleteMessages() = %d, %v, want 250, nil", n, err)
+		}
+		if cl.calls != 4 {
+			t.Errorf("calls = %d, want 4", cl.calls)
+		}
+		got := slices.Clone(ft.deleted[1])
+		slices.Sort(got)
+		if !slices.Equal(got, ids(msgs)) {
+			t.Errorf("deleted %d messages, want 250 once", len(got))
+		}
+	})
+}
+
+// pagedTelegram is the fake Telegram client, that requests the messages in
+// pages of two, and returns the flood wait on the floodCall-th request.
+type pagedTelegram struct {
+	*fakeTelegram
+	floodCall int
+	calls     int
+}
+
+func (pt *pagedTelegram) IterMyMessagesPaged(ctx context.Context, dlg mtp.Entity, offsetID int, before time.Time, do func(ctx context.Context, request func() error) error) iter.Seq2[messages.Elem, error] {
+	return func(yield func(messages.Elem, error) bool) {
+		var msgs []messages.Elem
+		for m := range pt.fakeTelegram.IterMyMessages(ctx, dlg, offsetID, before) {
+			msgs = append(msgs, m)
+		}
+		for page := range slices.Chunk(msgs, 2) {
+			err := do(ctx, func() error {
+				if pt.calls++; pt.calls == pt.floodCall {
+					return tgerr.New(420, "FLOOD_WAIT_0")
+				}
+				return nil
+			})
+			if err != nil {
+				yield(messages.Elem{}, err)
+				return
+			}
+			for _, m := range page {
+				if !yield(m, nil) {
+					return
+				}
+			}
+		}
+	}
+}
+
+func TestLimiter_scanPages(t *testing.T) {
+	ft := newFakeTelegram()
+	ft.addChat(1, "one", manyMessages(5)...)
+	l, _ := OpenLimiter("")
+	// the second page is rate limited, and only it is requested again.
+	cl := &pagedTelegram{fakeTelegram: ft, floodCall: 2}
+	var got []int
+	for m, err := range l.Wrap(cl).IterMyMessages(context.Background(), ft.chats[0], 0, time.Time{}) {
+		if err != nil {
+			t.Fatal(err)
+		}
+		got = append(got, m.Msg.GetID())
+	}
+	if !slices.Equal(got, []int{5, 4, 3, 2, 1}) {
+		t.Errorf("messages = %v, want [5 4 3 2 1]", got)
+	}
+	if cl.calls != 4 {
+		t.Errorf("requests = %d, want 4", cl.calls)
+	}
+	// each page after the flood wait is counted as the successful request.
+	if l.ok != 2 {
+		t.Errorf("successful requests = %d, want 2", l.ok)
+	}
+}
+
+func TestLimiter_Wrap(t *testing.T) {
+	l, _ := OpenLimiter("")
+	cl := l.Wrap(&fakeCounter{fakeArchive: newFakeArchive()})
+	if _, ok := cl.(fullClient); !ok {
+		t.Error("the optional interfaces of the client are not forwarded")
+	}
+	if l.Wrap(cl) != cl {
+		t.Error("the client is wrapped twice")
+	}
+	if _, ok := l.Wrap(newFakeTelegram()).(MessageCounter); ok {
+		t.Error("the client that can not count messages implements MessageCounter")
+	}
+}
+
+func TestLimiter_pacing(t *testing.T) {
+	l, _ := OpenLimiter("")
+	flood := tgerr.New(420, "FLOOD_WAIT_0")
+	for i, want := range []time.Duration{pacingStep, 2 * pacingStep, 4 * pacingStep} {
+		l.handle(flood)
+		if l.interval != want {
+			t.Errorf("flood wait %d: interval = %s, want %s", i+1, l.interval, want)
+		}
+	}
+	// the errors that are not flood waits do not speed the requests up.
+	for range relaxAfter {
+		l.handle(errors.New("boom"))
+	}
+	if l.interval != 4*pacingStep {
+		t.Errorf("interval after %d errors = %s, want %s", relaxAfter, l.interval, 4*pacingStep)
+	}
+	for range relaxAfter {
+		l.handle(nil)
+	}
+	if l.interval != 2*pacingStep {
+		t.Errorf("interval after %d requests = %s, want %s", relaxAfter, l.interval, 2*pacingStep)
+	}
+	for range 2 * relaxAfter {
+		l.handle(nil)
+	}
+	if l.interval != 0 {
+		t.Errorf("interval = %s, want 0", l.interval)
+	}
+	if l.handle(errors.New("boom")) {
+		t.Error("handle() retries the error that is not a flood wait")
+	}
+}
+
+func TestLimiter_persist(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "floodwait.json")
+	l, err := OpenLimiter(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the short wait is not saved.
+	l.handle(tgerr.New(420, "FLOOD_WAIT_5"))
+	if l, _ := OpenLimiter(filename); !l.until.IsZero() {
+		t.Errorf("the short flood wait was saved: %s", l.until)
+	}
+	l.handle(tgerr.New(420, "FLOOD_WAIT_3600"))
+
+	// the next run waits out the rest of the wait.
+	l, err = OpenLimiter(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if left := time.Until(l.until); left < 59*time.Minute || left > time.Hour {
+		t.Errorf("wait left = %s, want about 1h", left)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if _, err := l.Wrap(newFakeTelegram()).GetChats(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("GetChats() error = %v, want %v", err, context.DeadlineExceeded)
+	}
+}
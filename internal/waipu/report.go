@@ -0,0 +1,214 @@
+package waipu
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/gotd/td/telegram/auth"
+	mtp "github.com/rusq/mtpwrap"
+)
+
+var (
+	// ErrChatNotFound is returned, if some of the requested chats were not
+	// found, and the rest were wiped successfully.
+	ErrChatNotFound = errors.New("chat not found")
+	// ErrPartial is returned, if some of the chats failed.
+	ErrPartial = errors.New("some chats failed")
+	// ErrFailed is returned, if all chats failed.
+	ErrFailed = errors.New("all chats failed")
+)
+
+// Status is the result status of the chat in the report.
+type Status string
+
+const (
+	StatusOK          Status = "ok"
+	StatusDryRun      Status = "dry_run"
+	StatusPlanned     Status = "planned"
+	StatusFailed      Status = "failed"
+	StatusNotFound    Status = "not_found"
+	StatusInterrupted Status = "interrupted"
+	StatusProtected   Status = "protected"
+	StatusStopped     Status = "stopped"
+)
+
+// ChatResult is the result of wiping one chat.
+type ChatResult struct {
+	// Rule is the name of the configuration rule, if the chat was wiped
+	// by the rule.
+	Rule string `json:"rule,omitempty"`
+	// ID and Title are not set for the chats that were not found, Spec is
+	// the selector that did not match.
+	ID     int64  `json:"id,omitempty"`
+	Title  string `json:"title,omitempty"`
+	Spec   string `json:"spec,omitempty"`
+	Status Status `json:"status"`
+	// Found is the number of messages found by the scan, after the filter
+	// and retention, and Deleted is the number of deleted messages.
+	Found   int `json:"found"`
+	Deleted int `json:"deleted"`
+	// Left is the number of the user messages left in the chat, that was
+	// stopped because of the run limits, if it is known.  It includes the
+	// messages that are kept by the filter and retention.
+	Left  *int   `json:"left,omitempty"`
+	Error string `json:"error,omitempty"`
+	// Err is the error of the chat, Error is its text.  It is not saved, and
+	// is used by Report.Err to tell the authentication errors.
+	Err      error     `json:"-"`
+	Started  time.Time `json:"started,omitzero"`
+	Finished time.Time `json:"finished,omitzero"`
+}
+
+// Report is the report of the batch run.
+type Report struct {
+	Started  time.Time    `json:"started"`
+	Finished time.Time    `json:"finished"`
+	Found    int          `json:"found"`
+	Deleted  int          `json:"deleted"`
+	Chats    []ChatResult `json:"chats"`
+	// Error is the error of the run, see Err.
+	Error string `json:"error,omitempty"`
+}
+
+// WithReport adds the result of each chat to the report r.
+func WithReport(r *Report) Option {
+	return func(o *options) {
+		o.report = r
+	}
+}
+
+// notFound adds the chats that were not found.
+func (r *Report) notFound(rule string, specs []string) {
+	for _, spec := range specs {
+		r.Chats = append(r.Chats, ChatResult{Rule: rule, Spec: spec, Status: StatusNotFound, Error: ErrChatNotFound.Error(), Err: ErrChatNotFound})
+	}
+}
+
+// add adds the result of wiping the chat.
+func (r *Report) add(res ChatResult) {
+	r.Chats = append(r.Chats, res)
+	r.Found += res.Found
+	r.Deleted += res.Deleted
+}
+
+// finish sets the finish time and the error of the run.
+func (r *Report) finish() {
+	r.Finished = time.Now()
+	if err := r.Err(); err != nil {
+		r.Error = err.Error()
+	}
+}
+
+// Err returns nil, if all chats were wiped successfully, the protected
+// chats are skipped and are not considered failed.  Otherwise, it returns
+// the authentication error of the first chat that failed with it, see
+// IsAuthError, the error that matches context.Canceled, if the run was
+// interrupted, ErrFailed, if all chats failed, ErrPartial, if some of the
+// chats failed, ErrLimitReached, if some of the chats were stopped because
+// of the run limits, or ErrChatNotFound, if the only failure is that some of
+// the chats were not found.  The chats that were not found do not make the
+// run partial, so that ErrPartial means that the wipe itself failed.
+func (r *Report) Err() error {
+	var failed, notFound, interrupted, protected, stopped int
+	for _, c := range r.Chats {
+		if IsAuthError(c.Err) {
+			return fmt.Errorf("%s: %w", c.Title, c.Err)
+		}
+		switch c.Status {
+		case StatusFailed:
+			failed++
+		case StatusNotFound:
+			notFound++
+		case StatusInterrupted:
+			interrupted++
+		case StatusProtected:
+			protected++
+		case StatusStopped:
+			stopped++
+		}
+	}
+	switch {
+	case interrupted > 0:
+		return fmt.Errorf("interrupted, %d chats were not processed: %w", interrupted, context.Canceled)
+	case failed+notFound+protected == len(r.Chats) && failed > 0:
+		return fmt.Errorf("%w: %d chats", ErrFailed, failed)
+	case failed > 0:
+		return fmt.Errorf("%w: %d of %d chats", ErrPartial, failed, len(r.Chats))
+	case stopped > 0:
+		return fmt.Errorf("%w, %d chats were not finished", ErrLimitReached, stopped)
+	case notFound > 0:
+		return fmt.Errorf("%w: %d chats", ErrChatNotFound, notFound)
+	}
+	return nil
+}
+
+// IsAuthError returns true if err is the authentication error: the sign in
+// failed, there are no credentials, or the session is not authorized.
+func IsAuthError(err error) bool {
+	var errAuth *mtp.ErrAuth
+	return errors.As(err, &errAuth) || errors.Is(err, mtp.ErrNoCredentials) || auth.IsUnauthorized(err)
+}
+
+// Save writes the report to the file in JSON format.
+func (r *Report) Save(filename string) error {
+	data, err := json.MarshalIndent(r, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(filename, append(data, '\n'), 0o644)
+}
+
+// wipeChat wipes the chat, and returns its result.
+func wipeChat(ctx context.Context, w *Wiper, chat mtp.Entity) ChatResult {
+	res := ChatResult{
+		ID:      chat.GetID(),
+		Title:   chat.GetTitle(),
+		Started: time.Now(),
+	}
+	var err error
+	res.Found, res.Deleted, err = wipeEntity(ctx, w, chat)
+	res.Finished = time.Now()
+	res.Err = err
+	switch {
+	case ctx.Err() != nil:
+		res.Status = StatusInterrupted
+		res.Error = ctx.Err().Error()
+		res.Err = ctx.Err()
+	case errors.Is(err, ErrProtected):
+		res.Status = StatusProtected
+	case errors.Is(err, ErrLimitReached):
+		res.Status = StatusStopped
+		res.Error = err.Error()
+	case err != nil:
+		res.Status = StatusFailed
+		res.Error = err.Error()
+	case w.opts.dryRun != nil:
+		res.Status = StatusDryRun
+	case w.opts.plan != nil:
+		res.Status = StatusPlanned
+	default:
+		res.Status = StatusOK
+	}
+	return res
+}
+
+// interrupted returns the results for the chats that were not processed due
+// to the interruption.
+func interrupted(rule string, chats []mtp.Entity) []ChatResult {
+	ret := make([]ChatResult, 0, len(chats))
+	for _, chat := range chats {
+		ret = append(ret, ChatResult{
+			Rule:   rule,
+			ID:     chat.GetID(),
+			Title:  chat.GetTitle(),
+			Status: StatusInterrupted,
+			Error:  context.Canceled.Error(),
+			Err:    context.Canceled,
+		})
+	}
+	return ret
+}
@@ -0,0 +1,114 @@
+package waipu
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/gotd/td/telegram/query/messages"
+	"github.com/gotd/td/tgerr"
+	mtp "github.com/rusq/mtpwrap"
+)
+
+// failingTelegram fails to delete the messages in the chats listed in fail,
+// with the error err, or CHAT_WRITE_FORBIDDEN, if it is nil.
+type failingTelegram struct {
+	*fakeTelegram
+	fail map[int64]bool
+	err  error
+}
+
+func (ft failingTelegram) DeleteMessages(ctx context.Context, dlg mtp.Entity, msgs []messages.Elem) (int, error) {
+	if ft.fail[dlg.GetID()] {
+		if ft.err != nil {
+			return 0, ft.err
+		}
+		return 0, errors.New("CHAT_WRITE_FORBIDDEN")
+	}
+	return ft.fakeTelegram.DeleteMessages(ctx, dlg, msgs)
+}
+
+func TestBatch_report(t *testing.T) {
+	ft := newFakeTelegram()
+	ft.addChat(1, "one", testMsg(10, date("2020-01-01")), testMsg(11, date("2021-01-01")))
+	ft.addChat(2, "two", testMsg(20, date("2020-01-01")))
+	errUnauthorized := tgerr.New(401, "AUTH_KEY_UNREGISTERED")
+
+	tests := []struct {
+		name       string
+		fail       map[int64]bool
+		failErr    error
+		specs      []string
+		cancel     bool
+		wantErr    error
+		wantStatus []Status
+	}{
+		{"ok", nil, nil, []string{"1", "2"}, false, nil, []Status{StatusOK, StatusOK}},
+		{"not found", nil, nil, []string{"1", "3"}, false, ErrChatNotFound, []Status{StatusNotFound, StatusOK}},
+		{"partial", map[int64]bool{2: true}, nil, []string{"1", "2"}, false, ErrPartial, []Status{StatusOK, StatusFailed}},
+		{"partial and not found", map[int64]bool{2: true}, nil, []string{"1", "2", "3"}, false, ErrPartial, []Status{StatusNotFound, StatusOK, StatusFailed}},
+		{"failed", map[int64]bool{1: true, 2: true}, nil, []string{"1", "2", "3"}, false, ErrFailed, []Status{StatusNotFound, StatusFailed, StatusFailed}},
+		{"auth", map[int64]bool{2: true}, errUnauthorized, []string{"1", "2"}, false, errUnauthorized, []Status{StatusOK, StatusFailed}},
+		{"interrupted", nil, nil, []string{"1", "2"}, true, context.Canceled, []Status{StatusInterrupted, StatusInterrupted}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cl := failingTelegram{fakeTelegram: ft, fail: tt.fail, err: tt.failErr}
+			tgt := targets(t, cl, tt.specs...)
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			if tt.cancel {
+				cancel()
+			}
+			var rep Report
+			err := Batch(ctx, cl, tgt, WithReport(&rep))
+			if !errors.Is(err, tt.wantErr) || (tt.wantErr == nil) != (err == nil) {
+				t.Errorf("Batch() error = %v, want %v", err, tt.wantErr)
+			}
+			if len(rep.Chats) != len(tt.wantStatus) {
+				t.Fatalf("report chats = %+v", rep.Chats)
+			}
+			for i, want := range tt.wantStatus {
+				if got := rep.Chats[i].Status; got != want {
+					t.Errorf("chat %d status = %s, want %s", i, got, want)
+				}
+			}
+			if rep.Started.IsZero() || rep.Finished.Before(rep.Started) {
+				t.Errorf("report timings = %s .. %s", rep.Started, rep.Finished)
+			}
+			if (err == nil) != (rep.Error == "") {
+				t.Errorf("report error = %q, want %v", rep.Error, err)
+			}
+		})
+	}
+}
+
+func TestReport_Save(t *testing.T) {
+	ft := newFakeTelegram()
+	ft.addChat(1, "one", testMsg(10, date("2020-01-01")), testMsg(11, date("2021-01-01")))
+	var rep Report
+	if err := Batch(context.Background(), ft, targets(t, ft, "1"), WithReport(&rep), WithFilter(Filter{Before: date("2020-06-01")})); err != nil {
+		t.Fatal(err)
+	}
+	filename := filepath.Join(t.TempDir(), "report.json")
+	if err := rep.Save(filename); err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got Report
+	if err := json.Unmarshal(data, &got); err != nil {
+		t.Fatal(err)
+	}
+	if got.Found != 1 || got.Deleted != 1 || len(got.Chats) != 1 {
+		t.Fatalf("report = %+v", got)
+	}
+	if c := got.Chats[0]; c.ID != 1 || c.Title != "one" || c.Found != 1 || c.Deleted != 1 || c.Status != StatusOK {
+		t.Errorf("chat = %+v", c)
+	}
+}
@@ -0,0 +1,108 @@
+package waipu
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gotd/td/telegram/query/messages"
+)
+
+// Retention defines which of the most recent messages are kept in the chat.
+// Zero value keeps nothing.
+type Retention struct {
+	// KeepLast is the number of the most recent messages to keep.
+	KeepLast int
+	// KeepNewer keeps the messages that are newer than this.
+	KeepNewer time.Duration
+}
+
+// IsEmpty returns true if the retention keeps nothing.
+func (r Retention) IsEmpty() bool {
+	return r.KeepLast <= 0 && r.KeepNewer <= 0
+}
+
+// Apply sorts the messages newest first, and returns the messages that
+// should be deleted, i.e. the messages that are not kept.  The first of the
+// returned messages is the boundary: the newest message to be deleted.
+func (r Retention) Apply(msgs []messages.Elem, now time.Time) []messages.Elem {
+	if r.IsEmpty() {
+		return msgs
+	}
+	sorted := make([]messages.Elem, len(msgs))
+	copy(sorted, msgs)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		if sorted[i].Msg.GetDate() == sorted[j].Msg.GetDate() {
+			return sorted[i].Msg.GetID() > sorted[j].Msg.GetID()
+		}
+		return sorted[i].Msg.GetDate() > sorted[j].Msg.GetDate()
+	})
+	keep := 0
+	if r.KeepLast > 0 {
+		keep = min(r.KeepLast, len(sorted))
+	}
+	if r.KeepNewer > 0 {
+		cutoff := now.Add(-r.KeepNewer)
+		for keep < len(sorted) && msgDate(sorted[keep]).After(cutoff) {
+			keep++
+		}
+	}
+	return sorted[keep:]
+}
+
+// String returns the human readable representation of the retention.
+func (r Retention) String() string {
+	var parts []string
+	if r.KeepLast > 0 {
+		parts = append(parts, fmt.Sprintf("keep last %d messages", r.KeepLast))
+	}
+	if r.KeepNewer > 0 {
+		parts = append(parts, "keep messages newer than "+fmtAge(r.KeepNewer))
+	}
+	if len(parts) == 0 {
+		return "keep nothing"
+	}
+	return strings.Join(parts, ", ")
+}
+
+const (
+	day  = 24 * time.Hour
+	week = 7 * day
+)
+
+// ParseAge parses the age, that can be specified in days ("30d"), weeks
+// ("2w") or as Go duration ("36h").
+func ParseAge(s string) (time.Duration, error) {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return 0, nil
+	}
+	var unit time.Duration
+	switch {
+	case strings.HasSuffix(s, "d"):
+		unit = day
+	case strings.HasSuffix(s, "w"):
+		unit = week
+	default:
+		d, err := time.ParseDuration(s)
+		if err != nil {
+			return 0, fmt.Errorf("invalid age: %q, use i.e. 30d, 2w or 12h", s)
+		}
+		return d, nil
+	}
+	n, err := strconv.Atoi(s[:len(s)-1])
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("invalid age: %q, use i.e. 30d, 2w or 12h", s)
+	}
+	return time.Duration(n) * unit, nil
+}
+
+// fmtAge formats the age in days, if it's a whole number of days.
+func fmtAge(d time.Duration) string {
+	if d%day == 0 {
+		return strconv.Itoa(int(d/day)) + "d"
+	}
+	return d.String()
+}
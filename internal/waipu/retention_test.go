@@ -0,0 +1,71 @@
+package waipu
+
+import (
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/gotd/td/telegram/query/messages"
+)
+
+func ids(msgs []messages.Elem) []int {
+	ret := make([]int, len(msgs))
+	for i := range msgs {
+		ret[i] = msgs[i].Msg.GetID()
+	}
+	return ret
+}
+
+func TestRetention_Apply(t *testing.T) {
+	now := date("2024-01-31")
+	msgs := []messages.Elem{
+		testMsg(1, date("2024-01-01")),
+		testMsg(3, date("2024-01-30")),
+		testMsg(2, date("2024-01-15")),
+		testMsg(4, date("2024-01-30")),
+	}
+	tests := []struct {
+		name string
+		r    Retention
+		want []int
+	}{
+		{"empty keeps nothing", Retention{}, []int{1, 3, 2, 4}},
+		{"keep last 2", Retention{KeepLast: 2}, []int{2, 1}},
+		{"keep more than there is", Retention{KeepLast: 10}, []int{}},
+		{"keep newer than 10 days", Retention{KeepNewer: 10 * day}, []int{2, 1}},
+		{"keep newer than 20 days", Retention{KeepNewer: 20 * day}, []int{1}},
+		{"keep last 3 or newer than 10 days", Retention{KeepLast: 3, KeepNewer: 10 * day}, []int{1}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := ids(tt.r.Apply(msgs, now)); !slices.Equal(got, tt.want) {
+				t.Errorf("Apply() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseAge(t *testing.T) {
+	tests := []struct {
+		s       string
+		want    time.Duration
+		wantErr bool
+	}{
+		{"30d", 30 * day, false},
+		{"2w", 2 * week, false},
+		{"36h", 36 * time.Hour, false},
+		{"", 0, false},
+		{"xd", 0, true},
+		{"month", 0, true},
+	}
+	for _, tt := range tests {
+		got, err := ParseAge(tt.s)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("ParseAge(%q) error = %v, wantErr %v", tt.s, err, tt.wantErr)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("ParseAge(%q) = %v, want %v", tt.s, got, tt.want)
+		}
+	}
+}
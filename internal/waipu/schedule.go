@@ -0,0 +1,201 @@
+package waipu
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Schedule returns the time of the next run.
+type Schedule interface {
+	// Next returns the first scheduled time after t.
+	Next(t time.Time) time.Time
+	String() string
+}
+
+// ParseSchedule parses the schedule specification.  It accepts:
+//
+//   - "@every AGE" - run every AGE, i.e. "@every 6h" or "@every 1d";
+//   - "@hourly", "@daily" (or "@midnight"), "@weekly" and "@monthly";
+//   - cron expression with 5 fields: minute, hour, day of month, month and
+//     day of week, i.e. "30 3 * * *" runs every day at 03:30.  Fields
+//     accept "*", numbers, ranges "1-5", lists "1,3,5" and steps "*/15".
+func ParseSchedule(spec string) (Schedule, error) {
+	spec = strings.TrimSpace(spec)
+	if after, ok := strings.CutPrefix(spec, "@every "); ok {
+		d, err := ParseAge(after)
+		if err != nil {
+			return nil, err
+		}
+		if d < time.Second {
+			return nil, fmt.Errorf("invalid schedule: %q: interval is too short", spec)
+		}
+		return every(d), nil
+	}
+	switch spec {
+	case "@hourly":
+		spec = "0 * * * *"
+	case "@daily", "@midnight":
+		spec = "0 0 * * *"
+	case "@weekly":
+		spec = "0 0 * * 0"
+	case "@monthly":
+		spec = "0 0 1 * *"
+	}
+	cs, err := parseCron(spec)
+	if err != nil {
+		return nil, fmt.Errorf("invalid schedule: %q: %w", spec, err)
+	}
+	return cs, nil
+}
+
+// every is the schedule with the fixed interval.
+type every time.Duration
+
+func (e every) Next(t time.Time) time.Time {
+	return t.Add(time.Duration(e))
+}
+
+func (e every) String() string {
+	return "every " + fmtAge(time.Duration(e))
+}
+
+// cronSchedule is the schedule defined by the cron expression.  Each field is
+// the bit set of the allowed values.
+type cronSchedule struct {
+	spec                          string
+	minute, hour, dom, month, dow uint64
+	// domAny and dowAny are set if the day of month or the day of week is
+	// not restricted: it starts with "*", i.e. "*" or "*/2", as in cron, or
+	// allows all values, i.e. "1-31".  If both days are restricted, the day
+	// matches if either matches, like in cron.
+	domAny, dowAny bool
+}
+
+// cronField is the range of the cron field values.
+type cronField struct {
+	name     string
+	min, max int
+}
+
+var cronFields = [5]cronField{
+	{"minute", 0, 59},
+	{"hour", 0, 23},
+	{"day of month", 1, 31},
+	{"month", 1, 12},
+	{"day of week", 0, 7}, // 0 and 7 are Sunday
+}
+
+func parseCron(spec string) (*cronSchedule, error) {
+	fields := strings.Fields(spec)
+	if len(fields) != len(cronFields) {
+		return nil, errors.New("expected 5 fields: minute, hour, day of month, month and day of week")
+	}
+	var sets [5]uint64
+	for i, f := range fields {
+		set, err := parseCronField(f, cronFields[i])
+		if err != nil {
+			return nil, err
+		}
+		sets[i] = set
+	}
+	if sets[4]&(1<<7) != 0 {
+		sets[4] |= 1 // 7 is Sunday
+	}
+	return &cronSchedule{
+		spec:   spec,
+		minute: sets[0],
+		hour:   sets[1],
+		dom:    sets[2],
+		month:  sets[3],
+		dow:    sets[4],
+		domAny: strings.HasPrefix(fields[2], "*") || isFull(sets[2], cronFields[2]),
+		dowAny: strings.HasPrefix(fields[4], "*") || isFull(sets[4]|1<<7, cronFields[4]),
+	}, nil
+}
+
+// isFull returns true, if the set has all values of the field f.
+func isFull(set uint64, f cronField) bool {
+	all := uint64(1)<<(f.max+1) - uint64(1)<<f.min
+	return set&all == all
+}
+
+// parseCronField parses the comma separated list of values, ranges and
+// steps of the field f.
+func parseCronField(s string, f cronField) (uint64, error) {
+	var set uint64
+	for _, part := range strings.Split(s, ",") {
+		rng, stepStr, hasStep := strings.Cut(part, "/")
+		step := 1
+		if hasStep {
+			var err error
+			if step, err = strconv.Atoi(stepStr); err != nil || step < 1 {
+				return 0, fmt.Errorf("%s: invalid step: %q", f.name, part)
+			}
+		}
+		lo, hi := f.min, f.max
+		if rng != "*" {
+			loStr, hiStr, isRange := strings.Cut(rng, "-")
+			var err error
+			if lo, err = strconv.Atoi(loStr); err != nil {
+				return 0, fmt.Errorf("%s: invalid value: %q", f.name, part)
+			}
+			hi = lo
+			if isRange {
+				if hi, err = strconv.Atoi(hiStr); err != nil {
+					return 0, fmt.Errorf("%s: invalid value: %q", f.name, part)
+				}
+			} else if hasStep {
+				hi = f.max
+			}
+			if lo < f.min || hi > f.max || lo > hi {
+				return 0, fmt.Errorf("%s: %q is out of range %d-%d", f.name, part, f.min, f.max)
+			}
+		}
+		for v := lo; v <= hi; v += step {
+			set |= 1 << v
+		}
+	}
+	return set, nil
+}
+
+// maxCronSearch limits the search of the next run time, i.e. for "0 0 30 2 *"
+// that never fires.
+const maxCronSearch = 5 * 366 * 24 * time.Hour
+
+// Next returns the next time that matches the expression, or zero time if
+// there is none.
+func (c *cronSchedule) Next(t time.Time) time.Time {
+	limit := t.Add(maxCronSearch)
+	t = time.Date(t.Year(), t.Month(), t.Day(), t.Hour(), t.Minute()+1, 0, 0, t.Location())
+	for t.Before(limit) {
+		switch {
+		case c.month&(1<<uint(t.Month())) == 0:
+			t = time.Date(t.Year(), t.Month()+1, 1, 0, 0, 0, 0, t.Location())
+		case !c.matchDay(t):
+			t = time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, t.Location())
+		case c.hour&(1<<uint(t.Hour())) == 0:
+			t = time.Date(t.Year(), t.Month(), t.Day(), t.Hour()+1, 0, 0, 0, t.Location())
+		case c.minute&(1<<uint(t.Minute())) == 0:
+			t = t.Add(time.Minute)
+		default:
+			return t
+		}
+	}
+	return time.Time{}
+}
+
+func (c *cronSchedule) matchDay(t time.Time) bool {
+	dom := c.dom&(1<<uint(t.Day())) != 0
+	dow := c.dow&(1<<uint(t.Weekday())) != 0
+	if c.domAny || c.dowAny {
+		return dom && dow
+	}
+	return dom || dow
+}
+
+func (c *cronSchedule) String() string {
+	return c.spec
+}
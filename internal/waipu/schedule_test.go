@@ -0,0 +1,54 @@
+package waipu
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseSchedule(t *testing.T) {
+	from := time.Date(2024, 1, 31, 10, 15, 30, 0, time.UTC) // Wednesday
+	tests := []struct {
+		spec    string
+		want    time.Time
+		wantErr bool
+	}{
+		{spec: "@every 6h", want: from.Add(6 * time.Hour)},
+		{spec: "@every 1d", want: from.Add(24 * time.Hour)},
+		{spec: "@hourly", want: time.Date(2024, 1, 31, 11, 0, 0, 0, time.UTC)},
+		{spec: "@daily", want: time.Date(2024, 2, 1, 0, 0, 0, 0, time.UTC)},
+		{spec: "@weekly", want: time.Date(2024, 2, 4, 0, 0, 0, 0, time.UTC)},
+		{spec: "@monthly", want: time.Date(2024, 2, 1, 0, 0, 0, 0, time.UTC)},
+		{spec: "*/20 * * * *", want: time.Date(2024, 1, 31, 10, 20, 0, 0, time.UTC)},
+		{spec: "30 3 * * *", want: time.Date(2024, 2, 1, 3, 30, 0, 0, time.UTC)},
+		{spec: "0 9-17/4 * * 1-5", want: time.Date(2024, 1, 31, 13, 0, 0, 0, time.UTC)},
+		{spec: "0 0 29 2 *", want: time.Date(2024, 2, 29, 0, 0, 0, 0, time.UTC)},
+		{spec: "0 0 * * 7", want: time.Date(2024, 2, 4, 0, 0, 0, 0, time.UTC)},
+		{spec: "0 0 1 * 5", want: time.Date(2024, 2, 1, 0, 0, 0, 0, time.UTC)}, // 1st or Friday
+		{spec: "0 0 30 2 *", want: time.Time{}},
+		// the unrestricted day is "any", and the days are matched with AND.
+		{spec: "0 0 */1 * 1", want: time.Date(2024, 2, 5, 0, 0, 0, 0, time.UTC)},
+		{spec: "0 0 */2 * 1", want: time.Date(2024, 2, 5, 0, 0, 0, 0, time.UTC)},
+		{spec: "0 0 1-31 * 1", want: time.Date(2024, 2, 5, 0, 0, 0, 0, time.UTC)},
+		{spec: "0 0 15 * 0-6", want: time.Date(2024, 2, 15, 0, 0, 0, 0, time.UTC)},
+		{spec: "@every 1ms", wantErr: true},
+		{spec: "@every", wantErr: true},
+		{spec: "* * * *", wantErr: true},
+		{spec: "60 * * * *", wantErr: true},
+		{spec: "*/0 * * * *", wantErr: true},
+		{spec: "5-1 * * * *", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.spec, func(t *testing.T) {
+			s, err := ParseSchedule(tt.spec)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseSchedule() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			if got := s.Next(from); !got.Equal(tt.want) {
+				t.Errorf("Next() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,376 @@
+package waipu
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net/url"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/gotd/td/tg"
+	mtp "github.com/rusq/mtpwrap"
+)
+
+const (
+	prefixTitle  = "title:"
+	prefixType   = "type:"
+	prefixFolder = "folder:"
+	selectAll    = "all"
+)
+
+// Selector selects chats by the list of terms.  A chat is selected, if it
+// matches any of the terms.  The terms are:
+//
+//   - numeric chat ID;
+//   - "@username" - chat or channel username, or the link to it, i.e.
+//     "https://t.me/username";
+//   - "title:/REGEXP/" or "title:/REGEXP/i" - the title matches the regular
+//     expression, "i" flag makes it case-insensitive;
+//   - "title:TEXT" - the title contains TEXT, case-insensitive;
+//   - "type:TYPE" - chat type: private, group, megagroup, gigagroup or
+//     channel, "private" is only supported by the auto-delete, see
+//     Selector.HasPrivate;
+//   - "folder:NAME" - chats in the chat folder NAME, case-insensitive, see
+//     Selector.BindFolders;
+//   - "all" - all chats.
+type Selector struct {
+	terms []term
+}
+
+type term interface {
+	match(chat mtp.Entity) bool
+	String() string
+}
+
+// ParseSelector parses the selector terms.
+func ParseSelector(specs ...string) (Selector, error) {
+	var s Selector
+	for _, spec := range specs {
+		spec = strings.TrimSpace(spec)
+		if spec == "" {
+			continue
+		}
+		t, err := parseTerm(spec)
+		if err != nil {
+			return Selector{}, err
+		}
+		s.terms = append(s.terms, t)
+	}
+	return s, nil
+}
+
+func parseTerm(spec string) (term, error) {
+	switch {
+	case strings.EqualFold(spec, selectAll):
+		return allTerm{}, nil
+	case strings.HasPrefix(spec, prefixFolder):
+		name := strings.TrimSpace(strings.TrimPrefix(spec, prefixFolder))
+		if name == "" {
+			return nil, fmt.Errorf("invalid folder selector: %q", spec)
+		}
+		return &folderTerm{name: name}, nil
+	case strings.HasPrefix(spec, "@"):
+		return usernameTerm(strings.ToLower(strings.TrimPrefix(spec, "@"))), nil
+	case isLink(spec):
+		return parseLink(spec)
+	case strings.HasPrefix(spec, prefixTitle):
+		return parseTitle(spec, strings.TrimPrefix(spec, prefixTitle))
+	case strings.HasPrefix(spec, prefixType):
+		t := typeTerm(strings.ToLower(strings.TrimPrefix(spec, prefixType)))
+		if !t.valid() {
+			return nil, fmt.Errorf("invalid chat type: %q, must be one of: private, group, megagroup, gigagroup, channel", string(t))
+		}
+		return t, nil
+	}
+	id, err := strconv.ParseInt(spec, 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("invalid chat selector: %q", spec)
+	}
+	return idTerm(id), nil
+}
+
+// linkHosts are the hosts of the Telegram links.
+var linkHosts = []string{"t.me", "www.t.me", "telegram.me", "www.telegram.me"}
+
+// isLink returns true if spec looks like the Telegram link.
+func isLink(spec string) bool {
+	if strings.HasPrefix(spec, "tg://") {
+		return true
+	}
+	host, _, _ := strings.Cut(stripScheme(spec), "/")
+	return slices.Contains(linkHosts, strings.ToLower(host))
+}
+
+func stripScheme(s string) string {
+	if _, after, ok := strings.Cut(s, "://"); ok {
+		return after
+	}
+	return s
+}
+
+// parseLink parses the Telegram link: "https://t.me/username", the message
+// link "https://t.me/username/123", the private chat message link
+// "https://t.me/c/12345/123", or "tg://resolve?domain=username".
+func parseLink(spec string) (term, error) {
+	if strings.HasPrefix(spec, "tg://") {
+		u, err := url.Parse(spec)
+		if err != nil || u.Host != "resolve" || u.Query().Get("domain") == "" {
+			return nil, fmt.Errorf("unsupported link: %q", spec)
+		}
+		return usernameTerm(strings.ToLower(u.Query().Get("domain"))), nil
+	}
+	_, path, _ := strings.Cut(stripScheme(spec), "/")
+	path, _, _ = strings.Cut(path, "?")
+	parts := strings.Split(strings.Trim(path, "/"), "/")
+	switch {
+	case parts[0] == "":
+		return nil, fmt.Errorf("invalid link: %q", spec)
+	case parts[0] == "joinchat" || strings.HasPrefix(parts[0], "+"):
+		return nil, fmt.Errorf("invite links are not supported: %q", spec)
+	case parts[0] == "c" && len(parts) > 1:
+		id, err := strconv.ParseInt(parts[1], 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid link: %q", spec)
+		}
+		return idTerm(id), nil
+	case parts[0] == "s" && len(parts) > 1:
+		// public channel preview
+		return usernameTerm(strings.ToLower(parts[1])), nil
+	}
+	return usernameTerm(strings.ToLower(parts[0])), nil
+}
+
+// parseTitle parses the title term.
+func parseTitle(spec, val string) (term, error) {
+	if strings.TrimSpace(val) == "" {
+		// the empty title would match all chats.
+		return nil, fmt.Errorf("empty title selector: %q, use \"all\" to select all chats", spec)
+	}
+	if len(val) > 1 && strings.HasPrefix(val, "/") {
+		end := strings.LastIndex(val, "/")
+		if end == 0 {
+			return nil, fmt.Errorf("invalid title selector: %q", spec)
+		}
+		expr, flags := val[1:end], val[end+1:]
+		if expr == "" {
+			return nil, fmt.Errorf("empty title selector: %q, use \"all\" to select all chats", spec)
+		}
+		switch flags {
+		case "":
+		case "i":
+			expr = "(?i)" + expr
+		default:
+			return nil, fmt.Errorf("invalid regular expression flags in %q, only \"i\" is supported", spec)
+		}
+		re, err := regexp.Compile(expr)
+		if err != nil {
+			return nil, fmt.Errorf("invalid title selector %q: %w", spec, err)
+		}
+		return titleRegexp{re: re, spec: spec}, nil
+	}
+	return titleTerm(strings.ToLower(val)), nil
+}
+
+// SplitSelectors splits the comma separated list of selector terms.  Commas
+// inside the title regular expressions do not split the terms.
+func SplitSelectors(s string) []string {
+	parts := strings.Split(s, ",")
+	ret := make([]string, 0, len(parts))
+	for i := 0; i < len(parts); i++ {
+		p := parts[i]
+		if strings.HasPrefix(strings.TrimSpace(p), prefixTitle+"/") {
+			for !closedRegexp(p) && i+1 < len(parts) {
+				i++
+				p += "," + parts[i]
+			}
+		}
+		ret = append(ret, p)
+	}
+	return ret
+}
+
+// closedRegexp returns true if the title term has the closing slash of the
+// regular expression.
+func closedRegexp(s string) bool {
+	val := strings.TrimPrefix(strings.TrimSpace(s), prefixTitle)
+	end := strings.LastIndex(val, "/")
+	return end > 0 && (val[end+1:] == "" || val[end+1:] == "i")
+}
+
+// ReadSelectors reads the selector terms from r, one per line.  Empty lines
+// and lines starting with "#" are skipped.  If the line has tabs, only the
+// first field is used, so the output of List in TSV format can be read back,
+// the header line is skipped.
+func ReadSelectors(r io.Reader) ([]string, error) {
+	var specs []string
+	scanner := bufio.NewScanner(r)
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		if field, _, found := strings.Cut(line, "\t"); found {
+			if field == listHeader[0] {
+				continue
+			}
+			line = strings.TrimSpace(field)
+		}
+		if _, err := parseTerm(line); err != nil {
+			return nil, fmt.Errorf("line %d: %w", n, err)
+		}
+		specs = append(specs, line)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return specs, nil
+}
+
+// IsEmpty returns true if the selector has no terms.
+func (s Selector) IsEmpty() bool {
+	return len(s.terms) == 0
+}
+
+// HasFolders returns true if the selector has folder terms.
+func (s Selector) HasFolders() bool {
+	return slices.ContainsFunc(s.terms, func(t term) bool {
+		_, ok := t.(*folderTerm)
+		return ok
+	})
+}
+
+// HasPrivate returns true if the selector selects the private chats by the
+// type, "type:private".
+func (s Selector) HasPrivate() bool {
+	return slices.ContainsFunc(s.terms, func(t term) bool {
+		tt, ok := t.(typeTerm)
+		return ok && tt == "private"
+	})
+}
+
+// BindFolders returns the copy of the selector with the folder terms bound
+// to the folders.  Until bound, folder terms do not match any chat.
+func (s Selector) BindFolders(folders []Folder) (Selector, error) {
+	ret := Selector{terms: make([]term, len(s.terms))}
+	for i, t := range s.terms {
+		ft, ok := t.(*folderTerm)
+		if !ok {
+			ret.terms[i] = t
+			continue
+		}
+		idx := slices.IndexFunc(folders, func(f Folder) bool { return strings.EqualFold(f.Title, ft.name) })
+		if idx == -1 {
+			return Selector{}, fmt.Errorf("folder not found: %q", ft.name)
+		}
+		ret.terms[i] = &folderTerm{name: ft.name, folder: &folders[idx]}
+	}
+	return ret, nil
+}
+
+// Match returns true if the chat matches any of the terms.
+func (s Selector) Match(chat mtp.Entity) bool {
+	for _, t := range s.terms {
+		if t.match(chat) {
+			return true
+		}
+	}
+	return false
+}
+
+// Select returns the chats that match the selector.
+func (s Selector) Select(chats []mtp.Entity) []mtp.Entity {
+	var ret []mtp.Entity
+	for _, c := range chats {
+		if s.Match(c) {
+			ret = append(ret, c)
+		}
+	}
+	return ret
+}
+
+// String returns the comma separated list of the selector terms.
+func (s Selector) String() string {
+	ss := make([]string, len(s.terms))
+	for i, t := range s.terms {
+		ss[i] = t.String()
+	}
+	return strings.Join(ss, ",")
+}
+
+type allTerm struct{}
+
+func (allTerm) match(mtp.Entity) bool { return true }
+func (allTerm) String() string        { return selectAll }
+
+type folderTerm struct {
+	name   string
+	folder *Folder
+}
+
+func (t *folderTerm) match(chat mtp.Entity) bool {
+	return t.folder != nil && t.folder.Contains(chat)
+}
+func (t *folderTerm) String() string { return prefixFolder + t.name }
+
+type idTerm int64
+
+func (t idTerm) match(chat mtp.Entity) bool { return chat.GetID() == int64(t) }
+func (t idTerm) String() string             { return strconv.FormatInt(int64(t), 10) }
+
+type usernameTerm string
+
+func (t usernameTerm) match(chat mtp.Entity) bool {
+	name, ok := Username(chat)
+	return ok && strings.ToLower(name) == string(t)
+}
+func (t usernameTerm) String() string { return "@" + string(t) }
+
+type titleTerm string
+
+func (t titleTerm) match(chat mtp.Entity) bool {
+	return strings.Contains(strings.ToLower(chat.GetTitle()), string(t))
+}
+func (t titleTerm) String() string { return prefixTitle + string(t) }
+
+type titleRegexp struct {
+	re   *regexp.Regexp
+	spec string
+}
+
+func (t titleRegexp) match(chat mtp.Entity) bool { return t.re.MatchString(chat.GetTitle()) }
+func (t titleRegexp) String() string             { return t.spec }
+
+type typeTerm string
+
+func (t typeTerm) valid() bool {
+	switch t {
+	case "private", "group", "megagroup", "gigagroup", "channel":
+		return true
+	}
+	return false
+}
+func (t typeTerm) match(chat mtp.Entity) bool { return ChatType(chat) == string(t) }
+func (t typeTerm) String() string             { return prefixType + string(t) }
+
+// ChatType returns the chat type name: private, group, megagroup, gigagroup
+// or channel, or "unknown".
+func ChatType(chat mtp.Entity) string {
+	if chat.TypeInfo().ID == tg.UserTypeID {
+		return "private"
+	}
+	return strings.ToLower(mtp.DlgType(chat).String())
+}
+
+// Username returns the username of the chat, if it has one.
+func Username(chat mtp.Entity) (string, bool) {
+	switch c := chat.(type) {
+	case *tg.Channel:
+		return c.Username, c.Username != ""
+	case interface{ GetUsername() (string, bool) }:
+		return c.GetUsername()
+	}
+	return "", false
+}
@@ -0,0 +1,88 @@
+package waipu
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/gotd/td/telegram/query/messages"
+	mtp "github.com/rusq/mtpwrap"
+)
+
+// Stats is the summary of the messages.
+type Stats struct {
+	Count int
+	// First and Last are the dates of the oldest and the newest message.
+	First time.Time
+	Last  time.Time
+	// Kinds is the number of messages of each kind.
+	Kinds map[Kind]int
+}
+
+// Summarise returns the summary of the messages msgs.
+func Summarise(msgs []messages.Elem) Stats {
+	s := Stats{Kinds: make(map[Kind]int)}
+	for _, m := range msgs {
+		if m.Msg == nil {
+			continue
+		}
+		s.Count++
+		s.Kinds[KindOf(m)]++
+		date := msgDate(m)
+		if s.First.IsZero() || date.Before(s.First) {
+			s.First = date
+		}
+		if date.After(s.Last) {
+			s.Last = date
+		}
+	}
+	return s
+}
+
+// String returns the breakdown by kinds, i.e. "photo: 2, text: 10", the most
+// frequent kinds first.
+func (s Stats) String() string {
+	kinds := make([]Kind, 0, len(s.Kinds))
+	for k := range s.Kinds {
+		kinds = append(kinds, k)
+	}
+	sort.Slice(kinds, func(i, j int) bool {
+		if s.Kinds[kinds[i]] == s.Kinds[kinds[j]] {
+			return kinds[i] < kinds[j]
+		}
+		return s.Kinds[kinds[i]] > s.Kinds[kinds[j]]
+	})
+	parts := make([]string, len(kinds))
+	for i, k := range kinds {
+		parts[i] = fmt.Sprintf("%s: %d", k, s.Kinds[k])
+	}
+	return strings.Join(parts, ", ")
+}
+
+// printStats writes the dry-run report for the chat to w.
+func printStats(w io.Writer, chat mtp.Entity, s Stats) error {
+	if s.Count == 0 {
+		_, err := fmt.Fprintf(w, "%d (%s): no messages to delete\n", chat.GetID(), chat.GetTitle())
+		return err
+	}
+	_, err := fmt.Fprintf(w, "%d (%s): %d messages to delete, %s .. %s\n\t%s\n",
+		chat.GetID(), chat.GetTitle(), s.Count,
+		s.First.Format(time.DateTime), s.Last.Format(time.DateTime),
+		s,
+	)
+	return err
+}
+
+// printBoundary writes the boundary message, the newest message that will be
+// deleted, to w.
+func printBoundary(w io.Writer, m messages.Elem) error {
+	text := []rune(strings.Join(strings.Fields(msgText(m)), " "))
+	if len(text) > 40 {
+		text = append(text[:40], '…')
+	}
+	_, err := fmt.Fprintf(w, "\tnewest message to delete: #%d, %s, %s %q\n",
+		m.Msg.GetID(), msgDate(m).Format(time.DateTime), KindOf(m), string(text))
+	return err
+}
@@ -0,0 +1,113 @@
+package waipu
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"text/tabwriter"
+
+	"github.com/rusq/dlog"
+	mtp "github.com/rusq/mtpwrap"
+)
+
+// UsernameResolver is implemented by the Telegram clients that can resolve
+// the public usernames, including the chats that the user has left.
+type UsernameResolver interface {
+	ResolveUsername(ctx context.Context, username string) (mtp.Entity, error)
+}
+
+// Targets are the chats selected for wiping.
+type Targets struct {
+	Chats []mtp.Entity
+	// Missing are the chat IDs and usernames given explicitly, that were
+	// not found.
+	Missing []string
+}
+
+// ResolveTargets returns the chats selected by sel, in the order of the
+// selector terms.  Folder terms require cl to be a FolderLister.  Usernames
+// that are not in the chat list, i.e. chats that the user has left, are
+// resolved, if cl is a UsernameResolver.
+func ResolveTargets(ctx context.Context, cl Telegramer, sel Selector) (Targets, error) {
+	chats, err := cl.GetChats(ctx)
+	if err != nil {
+		return Targets{}, err
+	}
+	return resolveTargets(ctx, cl, chats, sel)
+}
+
+// resolveTargets returns the chats from chats, selected by sel.  The folders
+// are listed and the usernames are resolved with cl, if it is a
+// FolderLister and a UsernameResolver.
+func resolveTargets(ctx context.Context, cl any, chats []mtp.Entity, sel Selector) (Targets, error) {
+	if sel.HasFolders() {
+		fl, ok := cl.(FolderLister)
+		if !ok {
+			return Targets{}, errors.New("chat folders are not supported")
+		}
+		filters, err := fl.DialogFilters(ctx)
+		if err != nil {
+			return Targets{}, fmt.Errorf("failed to get chat folders: %w", err)
+		}
+		if sel, err = sel.BindFolders(FoldersOf(filters)); err != nil {
+			return Targets{}, err
+		}
+	}
+	var t Targets
+	seen := make(map[int64]bool)
+	for _, tm := range sel.terms {
+		found := false
+		for _, c := range chats {
+			if !tm.match(c) {
+				continue
+			}
+			found = true
+			if !seen[c.GetID()] {
+				seen[c.GetID()] = true
+				t.Chats = append(t.Chats, c)
+			}
+		}
+		if found {
+			continue
+		}
+		switch tm := tm.(type) {
+		case idTerm:
+			t.Missing = append(t.Missing, tm.String())
+		case usernameTerm:
+			chat, err := resolveUsername(ctx, cl, string(tm))
+			if err != nil {
+				dlog.Debugf("%s: %s", tm, err)
+				t.Missing = append(t.Missing, tm.String())
+				continue
+			}
+			if !seen[chat.GetID()] {
+				seen[chat.GetID()] = true
+				t.Chats = append(t.Chats, chat)
+			}
+		}
+	}
+	return t, nil
+}
+
+// PrintTargets writes the list of the target chats to w.
+func PrintTargets(w io.Writer, t Targets) error {
+	tw := tabwriter.NewWriter(w, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(tw, "ID\tTYPE\tTITLE")
+	for _, c := range t.Chats {
+		fmt.Fprintf(tw, "%d\t%s\t%s\n", c.GetID(), ChatType(c), c.GetTitle())
+	}
+	for _, spec := range t.Missing {
+		fmt.Fprintf(tw, "%s\t-\t(not found)\n", spec)
+	}
+	return tw.Flush()
+}
+
+// resolveUsername resolves the username, if cl is a UsernameResolver.
+func resolveUsername(ctx context.Context, cl any, username string) (mtp.Entity, error) {
+	r, ok := cl.(UsernameResolver)
+	if !ok {
+		return nil, errors.New("chat not found")
+	}
+	return r.ResolveUsername(ctx, username)
+}
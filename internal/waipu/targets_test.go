@@ -0,0 +1,124 @@
+package waipu
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"testing"
+
+	"github.com/gotd/td/tg"
+	mtp "github.com/rusq/mtpwrap"
+)
+
+// fakeFolders is the fake Telegram client with chat folders.
+type fakeFolders struct {
+	*fakeTelegram
+	filters []tg.DialogFilterClass
+}
+
+func (ff fakeFolders) DialogFilters(context.Context) ([]tg.DialogFilterClass, error) {
+	return ff.filters, nil
+}
+
+func TestResolveTargets(t *testing.T) {
+	ft := newFakeTelegram()
+	ft.addChat(1, "Work chat")
+	ft.addChat(2, "Family")
+	ft.addChat(3, "Crypto")
+	ft.chats = append(ft.chats, &tg.Channel{ID: 4, Title: "News", Broadcast: true})
+	cl := fakeFolders{
+		fakeTelegram: ft,
+		filters: []tg.DialogFilterClass{
+			&tg.DialogFilterDefault{},
+			&tg.DialogFilter{
+				Title:        tg.TextWithEntities{Text: "Work"},
+				IncludePeers: []tg.InputPeerClass{&tg.InputPeerChat{ChatID: 1}},
+				Broadcasts:   true,
+			},
+			&tg.DialogFilter{
+				Title:        tg.TextWithEntities{Text: "Groups"},
+				Groups:       true,
+				ExcludePeers: []tg.InputPeerClass{&tg.InputPeerChat{ChatID: 2}},
+			},
+		},
+	}
+	tests := []struct {
+		specs       []string
+		want        []int64
+		wantMissing []string
+		wantErr     bool
+	}{
+		{specs: []string{"3", "9", "1"}, want: []int64{3, 1}, wantMissing: []string{"9"}},
+		{specs: []string{"all"}, want: []int64{1, 2, 3, 4}},
+		{specs: []string{"folder:work"}, want: []int64{1, 4}},
+		{specs: []string{"folder:Groups", "2"}, want: []int64{1, 3, 2}},
+		{specs: []string{"type:channel", "title:crypto"}, want: []int64{4, 3}},
+		{specs: []string{"folder:Personal"}, wantErr: true},
+	}
+	for _, tt := range tests {
+		sel, err := ParseSelector(tt.specs...)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, err := ResolveTargets(context.Background(), cl, sel)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("ResolveTargets(%v) error = %v, wantErr %v", tt.specs, err, tt.wantErr)
+			continue
+		}
+		var ids []int64
+		for _, c := range got.Chats {
+			ids = append(ids, c.GetID())
+		}
+		if !slices.Equal(ids, tt.want) || !slices.Equal(got.Missing, tt.wantMissing) {
+			t.Errorf("ResolveTargets(%v) = %v, missing %v, want %v, missing %v", tt.specs, ids, got.Missing, tt.want, tt.wantMissing)
+		}
+	}
+
+	// folders are not supported by the client.
+	sel, _ := ParseSelector("folder:Work")
+	if _, err := ResolveTargets(context.Background(), ft, sel); err == nil {
+		t.Error("expected an error for the client without folders")
+	}
+}
+
+// fakeResolver is the fake Telegram client that resolves usernames.
+type fakeResolver struct {
+	*fakeTelegram
+	public map[string]*tg.Channel
+}
+
+func (fr fakeResolver) ResolveUsername(_ context.Context, username string) (mtp.Entity, error) {
+	if ch, ok := fr.public[username]; ok {
+		return ch, nil
+	}
+	return nil, errors.New("USERNAME_NOT_OCCUPIED")
+}
+
+func TestResolveTargets_username(t *testing.T) {
+	ft := newFakeTelegram()
+	ft.chats = append(ft.chats, &tg.Channel{ID: 1, Title: "Joined", Username: "joined", Megagroup: true})
+	cl := fakeResolver{
+		fakeTelegram: ft,
+		public:       map[string]*tg.Channel{"left": {ID: 2, Title: "Left", Username: "left", Megagroup: true, Left: true}},
+	}
+	for _, spec := range []string{"@left", "https://t.me/left", "t.me/left/123", "tg://resolve?domain=left"} {
+		got := targets(t, cl, "@joined", spec, "@nobody")
+		var ids []int64
+		for _, c := range got.Chats {
+			ids = append(ids, c.GetID())
+		}
+		if !slices.Equal(ids, []int64{1, 2}) || !slices.Equal(got.Missing, []string{"@nobody"}) {
+			t.Errorf("%s: chats = %v, missing = %v", spec, ids, got.Missing)
+		}
+	}
+
+	for _, spec := range []string{"https://t.me/+abcdef", "https://t.me/joinchat/abcdef", "t.me/", "tg://msg?to=1"} {
+		if _, err := ParseSelector(spec); err == nil {
+			t.Errorf("ParseSelector(%q) expected an error", spec)
+		}
+	}
+	sel, err := ParseSelector("https://t.me/c/12345/67")
+	if err != nil || sel.String() != "12345" {
+		t.Errorf("private link = %q, %v, want 12345", sel, err)
+	}
+}
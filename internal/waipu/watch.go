@@ -0,0 +1,312 @@
+package waipu
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/gotd/td/telegram/query/messages"
+	"github.com/gotd/td/tg"
+	"github.com/rusq/dlog"
+	mtp "github.com/rusq/mtpwrap"
+)
+
+// watchRetry is the delay before the failed deletion is retried.
+const watchRetry = time.Minute
+
+// Pending is the message scheduled for deletion.
+type Pending struct {
+	ChatID    int64     `json:"chat_id"`
+	MessageID int       `json:"message_id"`
+	DeleteAt  time.Time `json:"delete_at"`
+}
+
+// Journal is the persistent list of the messages scheduled for deletion.
+// It is saved on every change, so that the pending deletions survive the
+// restart.
+type Journal struct {
+	mu       sync.Mutex
+	filename string
+	pending  []Pending
+}
+
+// OpenJournal opens the journal file.  If the file does not exist, the
+// journal is empty, and the file is created on the first change.
+func OpenJournal(filename string) (*Journal, error) {
+	j := &Journal{filename: filename}
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return j, nil
+		}
+		return nil, err
+	}
+	if err := json.Unmarshal(data, &j.pending); err != nil {
+		return nil, fmt.Errorf("invalid journal %s: %w", filename, err)
+	}
+	return j, nil
+}
+
+// Len returns the number of the pending deletions.
+func (j *Journal) Len() int {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	return len(j.pending)
+}
+
+// add adds the pending deletion to the journal, unless it's already there.
+func (j *Journal) add(p Pending) error {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	if slices.ContainsFunc(j.pending, func(q Pending) bool {
+		return q.ChatID == p.ChatID && q.MessageID == p.MessageID
+	}) {
+		return nil
+	}
+	j.pending = append(j.pending, p)
+	return j.save()
+}
+
+// due returns the pending deletions that are due at now, by chat ID.
+func (j *Journal) due(now time.Time) map[int64][]Pending {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	ret := make(map[int64][]Pending)
+	for _, p := range j.pending {
+		if !p.DeleteAt.After(now) {
+			ret[p.ChatID] = append(ret[p.ChatID], p)
+		}
+	}
+	return ret
+}
+
+// next returns the earliest deletion time, or zero time if there is nothing
+// pending.
+func (j *Journal) next() time.Time {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	var ret time.Time
+	for _, p := range j.pending {
+		if ret.IsZero() || p.DeleteAt.Before(ret) {
+			ret = p.DeleteAt
+		}
+	}
+	return ret
+}
+
+// postpone moves the deletion time of the pending messages ps to at.
+func (j *Journal) postpone(ps []Pending, at time.Time) error {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	for i := range j.pending {
+		if slices.ContainsFunc(ps, func(p Pending) bool { return p == j.pending[i] }) {
+			j.pending[i].DeleteAt = at
+		}
+	}
+	return j.save()
+}
+
+// remove removes the pending messages ps from the journal.
+func (j *Journal) remove(ps []Pending) error {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	j.pending = slices.DeleteFunc(j.pending, func(q Pending) bool {
+		return slices.Contains(ps, q)
+	})
+	return j.save()
+}
+
+// save writes the journal to the file.  It must be called with the mutex
+// held.
+func (j *Journal) save() error {
+	data, err := json.Marshal(j.pending)
+	if err != nil {
+		return err
+	}
+	tmp := j.filename + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, j.filename)
+}
+
+// Watcher schedules the deletion of the own outgoing messages in the
+// selected chats after the TTL, and deletes them when it expires.  The
+// messages are received from the update stream.  Messages sent while the
+// watcher is not running are not seen by it.  Private chats are not
+// supported, see Selector.HasPrivate.
+type Watcher struct {
+	wiper   *Wiper
+	sel     Selector
+	ttl     time.Duration
+	journal *Journal
+
+	mu    sync.Mutex
+	chats map[int64]mtp.Entity
+	wake  chan struct{}
+}
+
+// NewWatcher creates the watcher that deletes the messages in the chats
+// selected by sel, after ttl.
+func NewWatcher(cl Telegramer, sel Selector, ttl time.Duration, journal *Journal, opts ...Option) *Watcher {
+	return &Watcher{
+		wiper:   NewWiper(cl, opts...),
+		sel:     sel,
+		ttl:     ttl,
+		journal: journal,
+		chats:   make(map[int64]mtp.Entity),
+		wake:    make(chan struct{}, 1),
+	}
+}
+
+// Register registers the update handlers of the watcher in the dispatcher.
+// It must be called before the client is started.  The dispatcher does not
+// handle the short updates, that Telegram sends for the basic groups, so it
+// should receive the updates through the gotd updates manager, that expands
+// the short updates and recovers the gaps in the update stream.
+func (w *Watcher) Register(d tg.UpdateDispatcher) {
+	d.OnNewMessage(func(ctx context.Context, e tg.Entities, u *tg.UpdateNewMessage) error {
+		return w.handleMessage(e, u.Message)
+	})
+	d.OnNewChannelMessage(func(ctx context.Context, e tg.Entities, u *tg.UpdateNewChannelMessage) error {
+		return w.handleMessage(e, u.Message)
+	})
+}
+
+// handleMessage schedules the deletion of the message, if it's the outgoing
+// message in one of the selected chats.
+func (w *Watcher) handleMessage(e tg.Entities, msg tg.MessageClass) error {
+	m, ok := msg.(*tg.Message)
+	if !ok || !m.Out {
+		return nil
+	}
+	chat, ok := w.entity(e, m.PeerID)
+	if !ok || !w.sel.Match(chat) || w.wiper.IsProtected(chat) {
+		return nil
+	}
+	p := Pending{
+		ChatID:    chat.GetID(),
+		MessageID: m.ID,
+		DeleteAt:  time.Unix(int64(m.Date), 0).Add(w.ttl),
+	}
+	dlog.Debugf("watcher: chat %d: message %d scheduled for deletion at %s", p.ChatID, p.MessageID, p.DeleteAt.Format(time.DateTime))
+	if err := w.journal.add(p); err != nil {
+		return fmt.Errorf("failed to update the journal: %w", err)
+	}
+	select {
+	case w.wake <- struct{}{}:
+	default:
+	}
+	return nil
+}
+
+// entity returns the chat of the peer, from the known chats or the update
+// entities.
+func (w *Watcher) entity(e tg.Entities, peer tg.PeerClass) (mtp.Entity, bool) {
+	var id int64
+	switch p := peer.(type) {
+	case *tg.PeerChat:
+		id = p.ChatID
+	case *tg.PeerChannel:
+		id = p.ChannelID
+	case *tg.PeerUser:
+		dlog.Debugf("watcher: the private chat with user %d is skipped, private chats are not supported", p.UserID)
+		return nil, false
+	default:
+		return nil, false
+	}
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if chat, ok := w.chats[id]; ok {
+		return chat, true
+	}
+	var chat mtp.Entity
+	if c, ok := e.Chats[id]; ok {
+		chat = c
+	} else if c, ok := e.Channels[id]; ok {
+		chat = c
+	} else {
+		return nil, false
+	}
+	w.chats[id] = chat
+	return chat, true
+}
+
+// Run deletes the messages from the journal when they are due, until the
+// context is cancelled.
+func (w *Watcher) Run(ctx context.Context) error {
+	chats, err := w.wiper.cl.GetChats(ctx)
+	if err != nil {
+		return err
+	}
+	w.mu.Lock()
+	for _, c := range chats {
+		w.chats[c.GetID()] = c
+	}
+	w.mu.Unlock()
+	dlog.Printf("watcher: %d chats selected (%s), TTL: %s, pending deletions: %d", len(w.sel.Select(chats)), w.sel, fmtAge(w.ttl), w.journal.Len())
+
+	for {
+		w.deleteDue(ctx, time.Now())
+
+		var timer = time.NewTimer(time.Hour)
+		if next := w.journal.next(); !next.IsZero() {
+			timer.Reset(time.Until(next))
+		}
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			dlog.Printf("watcher: stopped, pending deletions: %d", w.journal.Len())
+			return nil
+		case <-w.wake:
+		case <-timer.C:
+		}
+		timer.Stop()
+	}
+}
+
+// deleteDue deletes the messages that are due at now.  Failed deletions are
+// retried later.
+func (w *Watcher) deleteDue(ctx context.Context, now time.Time) {
+	for chatID, ps := range w.journal.due(now) {
+		if ctx.Err() != nil {
+			return
+		}
+		w.mu.Lock()
+		chat, ok := w.chats[chatID]
+		w.mu.Unlock()
+		if !ok {
+			dlog.Printf("watcher: chat %d not found, dropping %d pending deletions", chatID, len(ps))
+			if err := w.journal.remove(ps); err != nil {
+				dlog.Printf("watcher: failed to update the journal: %s", err)
+			}
+			continue
+		}
+		elems := make([]messages.Elem, len(ps))
+		for i, p := range ps {
+			elems[i] = messages.Elem{Msg: &tg.Message{ID: p.MessageID}}
+		}
+		if _, err := w.wiper.Delete(ctx, chat, elems); errors.Is(err, ErrProtected) {
+			dlog.Printf("watcher: chat %d is protected, dropping %d pending deletions", chatID, len(ps))
+			if err := w.journal.remove(ps); err != nil {
+				dlog.Printf("watcher: failed to update the journal: %s", err)
+			}
+			continue
+		} else if err != nil {
+			dlog.Printf("watcher: chat %d: error deleting messages %s, retrying in %s", chatID, err, watchRetry)
+			if err := w.journal.postpone(ps, now.Add(watchRetry)); err != nil {
+				dlog.Printf("watcher: failed to update the journal: %s", err)
+			}
+			continue
+		}
+		dlog.Printf("watcher: chat %d: messages deleted: %d", chatID, len(ps))
+		if err := w.journal.remove(ps); err != nil {
+			dlog.Printf("watcher: failed to update the journal: %s", err)
+		}
+	}
+}
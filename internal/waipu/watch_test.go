@@ -0,0 +1,167 @@
+package waipu
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/gotd/td/telegram/updates"
+	"github.com/gotd/td/tg"
+)
+
+func TestWatcher(t *testing.T) {
+	ft := newFakeTelegram()
+	ft.addChat(1, "watched")
+	ft.addChat(2, "other")
+	sel, err := ParseSelector("title:watched")
+	if err != nil {
+		t.Fatal(err)
+	}
+	filename := filepath.Join(t.TempDir(), "journal.json")
+	journal, err := OpenJournal(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	w := NewWatcher(ft, sel, time.Hour, journal)
+	// the chat is taken from the update entities before the chats are
+	// loaded.
+	e := tg.Entities{Chats: map[int64]*tg.Chat{1: {ID: 1, Title: "watched"}, 2: {ID: 2, Title: "other"}}}
+	now := int(time.Now().Unix())
+	for _, m := range []*tg.Message{
+		{ID: 10, Out: true, PeerID: &tg.PeerChat{ChatID: 1}, Date: now - 7200}, // due
+		{ID: 11, Out: true, PeerID: &tg.PeerChat{ChatID: 1}, Date: now},        // pending
+		{ID: 12, Out: false, PeerID: &tg.PeerChat{ChatID: 1}, Date: now - 7200},
+		{ID: 20, Out: true, PeerID: &tg.PeerChat{ChatID: 2}, Date: now - 7200},
+		{ID: 30, Out: true, PeerID: &tg.PeerUser{UserID: 3}, Date: now - 7200},
+	} {
+		if err := w.handleMessage(e, m); err != nil {
+			t.Fatalf("handleMessage(%d) error = %v", m.ID, err)
+		}
+	}
+	if n := journal.Len(); n != 2 {
+		t.Fatalf("pending = %d, want 2", n)
+	}
+
+	// the journal survives the restart.
+	if journal, err = OpenJournal(filename); err != nil {
+		t.Fatal(err)
+	}
+	w = NewWatcher(ft, sel, time.Hour, journal)
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if err := w.Run(ctx); err != nil {
+		t.Fatalf("Run() error = %v", err)
+	}
+	if got := ft.deleted[1]; !slices.Equal(got, []int{10}) {
+		t.Errorf("deleted = %v, want [10]", got)
+	}
+	if len(ft.deleted[2]) != 0 {
+		t.Errorf("chat 2 is not watched, but messages were deleted: %v", ft.deleted[2])
+	}
+	if journal, err = OpenJournal(filename); err != nil {
+		t.Fatal(err)
+	}
+	if n := journal.Len(); n != 1 {
+		t.Errorf("pending after run = %d, want 1", n)
+	}
+}
+
+func TestWatcher_protected(t *testing.T) {
+	ft := newFakeTelegram()
+	ft.addChat(1, "watched")
+	journal, err := OpenJournal(filepath.Join(t.TempDir(), "journal.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the message was scheduled before the chat was protected.
+	if err := journal.add(Pending{ChatID: 1, MessageID: 10, DeleteAt: time.Now().Add(-time.Minute)}); err != nil {
+		t.Fatal(err)
+	}
+	w := NewWatcher(ft, mustSelector(t, "1"), time.Hour, journal, WithProtected(newProtected(t, ft.chats[0])))
+	w.chats[1] = ft.chats[0]
+
+	m := &tg.Message{ID: 11, Out: true, PeerID: &tg.PeerChat{ChatID: 1}, Date: int(time.Now().Unix())}
+	if err := w.handleMessage(tg.Entities{}, m); err != nil {
+		t.Fatal(err)
+	}
+	if n := journal.Len(); n != 1 {
+		t.Errorf("message in the protected chat was scheduled, pending = %d", n)
+	}
+	w.deleteDue(context.Background(), time.Now())
+	if len(ft.deleted[1]) != 0 {
+		t.Errorf("messages deleted in the protected chat: %v", ft.deleted[1])
+	}
+	if n := journal.Len(); n != 0 {
+		t.Errorf("pending deletions in the protected chat were not dropped, pending = %d", n)
+	}
+}
+
+// fakeUpdatesAPI is the updates API with the empty state, that has no
+// missed updates.
+type fakeUpdatesAPI struct{}
+
+func (fakeUpdatesAPI) UpdatesGetState(context.Context) (*tg.UpdatesState, error) {
+	return &tg.UpdatesState{Pts: 1, Date: int(time.Now().Unix())}, nil
+}
+
+func (fakeUpdatesAPI) UpdatesGetDifference(context.Context, *tg.UpdatesGetDifferenceRequest) (tg.UpdatesDifferenceClass, error) {
+	return &tg.UpdatesDifferenceEmpty{Date: int(time.Now().Unix())}, nil
+}
+
+func (fakeUpdatesAPI) UpdatesGetChannelDifference(context.Context, *tg.UpdatesGetChannelDifferenceRequest) (tg.UpdatesChannelDifferenceClass, error) {
+	return nil, errors.New("not supported")
+}
+
+func TestWatcher_shortChatMessage(t *testing.T) {
+	ft := newFakeTelegram()
+	ft.addChat(1, "watched")
+	journal, err := OpenJournal(filepath.Join(t.TempDir(), "journal.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	w := NewWatcher(ft, mustSelector(t, "1"), time.Hour, journal)
+	// the short updates have no entities, the chat is known from the chat
+	// list.
+	w.chats[1] = ft.chats[0]
+	dispatcher := tg.NewUpdateDispatcher()
+	w.Register(dispatcher)
+	gaps := updates.New(updates.Config{Handler: dispatcher})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	started := make(chan struct{})
+	done := make(chan error, 1)
+	go func() {
+		done <- gaps.Run(ctx, fakeUpdatesAPI{}, 42, updates.AuthOptions{OnStart: func(context.Context) { close(started) }})
+	}()
+	select {
+	case <-started:
+	case err := <-done:
+		t.Fatalf("Run() error = %v", err)
+	}
+
+	now := int(time.Now().Unix())
+	for _, u := range []tg.UpdatesClass{
+		&tg.UpdateShortChatMessage{Out: true, ID: 10, FromID: 42, ChatID: 1, Pts: 2, PtsCount: 1, Date: now},
+		&tg.UpdateShortChatMessage{Out: false, ID: 11, FromID: 7, ChatID: 1, Pts: 3, PtsCount: 1, Date: now},
+	} {
+		if err := gaps.Handle(ctx, u); err != nil {
+			t.Fatalf("Handle() error = %v", err)
+		}
+	}
+	deadline := time.Now().Add(5 * time.Second)
+	for journal.Len() == 0 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	cancel()
+	<-done
+	if n := journal.Len(); n != 1 {
+		t.Fatalf("pending = %d, want 1", n)
+	}
+	if due := journal.due(time.Now().Add(2 * time.Hour)); len(due[1]) != 1 || due[1][0].MessageID != 10 {
+		t.Errorf("pending = %v, want message 10 in chat 1", due)
+	}
+}
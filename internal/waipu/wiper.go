@@ -0,0 +1,243 @@
+package waipu
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+
+	"github.com/gotd/td/telegram/query/messages"
+	mtp "github.com/rusq/mtpwrap"
+)
+
+// Wiper finds and deletes the messages of the current user.  It is shared by
+// the batch mode and the text UI, so that both apply the same rules.
+type Wiper struct {
+	cl   Telegramer
+	opts options
+
+	mu sync.Mutex
+	// pending are the high-water marks of the scanned chats, that are saved
+	// once the messages are deleted.
+	pending map[int64]Mark
+}
+
+// Option is the Wiper option.
+type Option func(*options)
+
+type options struct {
+	filter    Filter
+	retention Retention
+	// dryRun is the writer for the dry-run report.  If set, messages are
+	// not deleted.
+	dryRun io.Writer
+	// plan, if set, receives the found messages instead of deletion.
+	plan *Plan
+	// exporter, if set, saves the messages before deletion.
+	exporter Exporter
+	// report, if set, receives the result of each chat.
+	report *Report
+	// protected are the chats that must not be touched.
+	protected *Protected
+	// checkpoints, if set, records the progress of each chat, and resume
+	// continues the wipe from the checkpoint.
+	checkpoints *Checkpoints
+	resume      bool
+	// marks, if set, are the high-water marks of the incremental wipes, and
+	// full requests the complete scan.
+	marks *Marks
+	full  bool
+	// limiter, if set, paces the requests and waits out the flood waits.
+	limiter *Limiter
+	// limits are the limits of the run, and budget is what is left of
+	// them, see startBudget.
+	limits Limits
+	budget *budget
+}
+
+// WithFilter sets the filter that is applied to the found messages.
+func WithFilter(f Filter) Option {
+	return func(o *options) {
+		o.filter = f
+	}
+}
+
+// deletes returns true if the messages are deleted, and not only reported
+// or planned.
+func (o *options) deletes() bool {
+	return o.dryRun == nil && o.plan == nil
+}
+
+// WithRetention sets the retention, that keeps the most recent messages.
+func WithRetention(r Retention) Option {
+	return func(o *options) {
+		o.retention = r
+	}
+}
+
+// WithDryRun enables the dry-run mode: the chats are scanned, and the report
+// is written to w, but no messages are deleted.  Nil w disables the dry-run.
+func WithDryRun(w io.Writer) Option {
+	return func(o *options) {
+		o.dryRun = w
+	}
+}
+
+// WithPlan enables the planning mode: the found messages are added to the
+// plan p, and are not deleted.
+func WithPlan(p *Plan) Option {
+	return func(o *options) {
+		o.plan = p
+	}
+}
+
+// WithExporter sets the exporter, that saves the messages before they are
+// deleted.
+func WithExporter(e Exporter) Option {
+	return func(o *options) {
+		o.exporter = e
+	}
+}
+
+// NewWiper creates a new Wiper.
+func NewWiper(cl Telegramer, opts ...Option) *Wiper {
+	w := &Wiper{cl: cl}
+	for _, opt := range opts {
+		opt(&w.opts)
+	}
+	if w.opts.limiter != nil {
+		w.cl = w.opts.limiter.Wrap(cl)
+	}
+	return w
+}
+
+// Filter returns the current message filter.
+func (w *Wiper) Filter() Filter {
+	return w.opts.filter
+}
+
+// Exports returns true if the messages are exported before deletion.
+func (w *Wiper) Exports() bool {
+	return w.opts.exporter != nil
+}
+
+// SetFilter replaces the current message filter.
+func (w *Wiper) SetFilter(f Filter) {
+	w.opts.filter = f
+}
+
+// IsProtected returns true if the chat is protected, see WithProtected.
+func (w *Wiper) IsProtected(chat mtp.Entity) bool {
+	return w.opts.protected.Contains(chat.GetID())
+}
+
+// Retention returns the retention.
+func (w *Wiper) Retention() Retention {
+	return w.opts.retention
+}
+
+// Scan returns the messages of the current user in the chat, that satisfy
+// the filter and are not kept by the retention.  For each API call, the
+// callback function will be invoked, if not nil.  Protected chats are not
+// scanned, ErrProtected is returned.
+func (w *Wiper) Scan(ctx context.Context, chat mtp.Entity, cb func(n int)) ([]messages.Elem, error) {
+	if w.IsProtected(chat) {
+		return nil, ErrProtected
+	}
+	minID := w.minID(chat.GetID())
+	if w.checkpointed() {
+		return w.scanCheckpoint(ctx, chat, minID, cb)
+	}
+	var (
+		newest PlanMessage
+		found  []messages.Elem
+	)
+	if err := w.search(ctx, chat, 0, minID, cb, func(m messages.Elem) error {
+		if m.Msg.GetID() > newest.ID {
+			newest = planMessage(m)
+		}
+		if w.opts.filter.Match(m) {
+			found = append(found, m)
+		}
+		return nil
+	}); err != nil {
+		return nil, err
+	}
+	msgs := w.opts.retention.Apply(found, time.Now())
+	w.setPending(chat.GetID(), markOf(newest, found, msgs))
+	return msgs, nil
+}
+
+// search calls fn for each message of the current user in the chat, newest
+// first, starting with the message older than offsetID, if it is not zero,
+// and stopping at the message with minID, or older, so that the older
+// messages are not requested.  The date range of the filter limits the
+// search too: it starts at the "before" date, and stops at the first message
+// older than the "after" date.
+func (w *Wiper) search(ctx context.Context, chat mtp.Entity, offsetID, minID int, cb func(n int), fn func(m messages.Elem) error) error {
+	after := w.opts.filter.After
+	for m, err := range w.cl.IterMyMessages(ctx, chat, offsetID, w.opts.filter.Before) {
+		if err != nil {
+			return err
+		}
+		if m.Msg.GetID() <= minID {
+			break
+		}
+		if !after.IsZero() && msgDate(m).Before(after) {
+			// the messages are sorted newest first, the rest are older.
+			break
+		}
+		if err := fn(m); err != nil {
+			return err
+		}
+		if cb != nil {
+			cb(1)
+		}
+	}
+	return nil
+}
+
+// Delete deletes the messages msgs in the chat.  If the exporter is set, the
+// messages are exported first, and are not deleted if the export fails.  It
+// returns the number of deleted messages.  Messages in the protected chats
+// are not deleted, ErrProtected is returned.
+func (w *Wiper) Delete(ctx context.Context, chat mtp.Entity, msgs []messages.Elem) (int, error) {
+	if w.IsProtected(chat) {
+		return 0, ErrProtected
+	}
+	if err := w.export(ctx, chat, msgs); err != nil {
+		return 0, fmt.Errorf("messages were not deleted: %w", err)
+	}
+	n, err := w.delete(ctx, chat, msgs)
+	if err != nil {
+		return n, err
+	}
+	if err := w.commitMark(chat.GetID()); err != nil {
+		return n, fmt.Errorf("failed to save the high-water mark: %w", err)
+	}
+	return n, nil
+}
+
+// delete deletes the messages, recording the progress in the checkpoint, if
+// the checkpoints are enabled.
+func (w *Wiper) delete(ctx context.Context, chat mtp.Entity, msgs []messages.Elem) (int, error) {
+	if w.checkpointed() {
+		return w.deleteCheckpoint(ctx, chat, msgs)
+	}
+	if len(msgs) == 0 {
+		return 0, nil
+	}
+	return w.cl.DeleteMessages(ctx, chat, msgs)
+}
+
+// export exports the messages, if the exporter is set.
+func (w *Wiper) export(ctx context.Context, chat mtp.Entity, msgs []messages.Elem) error {
+	if w.opts.exporter == nil || len(msgs) == 0 {
+		return nil
+	}
+	if err := w.opts.exporter.Export(ctx, chat, msgs); err != nil {
+		return fmt.Errorf("export failed: %w", err)
+	}
+	return nil
+}
@@ -1,7 +1,9 @@
 package main
 
 import (
+	"bufio"
 	"context"
+	"errors"
 	"flag"
 	"fmt"
 	"io"
@@ -9,13 +11,14 @@ import (
 	"os/signal"
 	"path/filepath"
 	"sort"
-	"strconv"
 	"strings"
 	"syscall"
 	"time"
 
 	"github.com/fatih/color"
 	"github.com/gotd/td/telegram"
+	"github.com/gotd/td/telegram/updates"
+	"github.com/gotd/td/tg"
 	"github.com/joho/godotenv"
 	"github.com/rusq/dlog"
 	"github.com/rusq/osenv/v2"
@@ -25,7 +28,9 @@ import (
 	mtp "github.com/rusq/mtpwrap"
 	"github.com/rusq/mtpwrap/authflow"
 
+	"github.com/rusq/wipemychat/internal/export"
 	"github.com/rusq/wipemychat/internal/session"
+	"github.com/rusq/wipemychat/internal/tgclient"
 	"github.com/rusq/wipemychat/internal/tui"
 	"github.com/rusq/wipemychat/internal/waipu"
 )
@@ -56,14 +61,100 @@ type Params struct {
 	// Logout requests removal of the session file.
 	Logout bool
 
-	List  bool
-	Batch chatIDs
+	List bool
+	// ListFormat is the output format of the chat list.
+	ListFormat string
+	// ListFilter selects the chats to list.
+	ListFilter chatSelectors
+	// Count adds the number of the user messages to the chat list in -list
+	// and in the GUI.
+	Count bool
+
+	Batch chatSelectors
+	// WipeFile is the file with the chat IDs and selectors to wipe, one per
+	// line, "-" for stdin.
+	WipeFile string
+	// Yes skips the confirmation of the batch wipe.
+	Yes bool
+	// DryRun requests the report of the messages that would be deleted.
+	DryRun bool
+	// Plan is the file to save the plan to, instead of deleting messages.
+	Plan string
+	// Apply is the plan file to apply.
+	Apply string
+	// Report is the file to save the JSON report of the batch run to.
+	Report string
+	// Resume continues the interrupted wipe from the checkpoints.
+	Resume bool
+	// Full forces the complete scan of the chats in the batch mode, instead
+	// of scanning only the messages newer than the last run.
+	Full bool
+	// MaxMessages and MaxDuration limit the number of messages deleted in
+	// one batch run, and its duration.
+	MaxMessages int
+	MaxDuration time.Duration
+	// ExportDir is the directory to export messages to before deletion.
+	ExportDir string
+	// Media enables the download of media files to the export directory.
+	Media bool
+	// ExportFormat is the export format, json or html.
+	ExportFormat string
+
+	// Before and After limit the date range of the messages to be deleted.
+	Before dateFlag
+	After  dateFlag
+	// Kinds limits the types of the messages to be deleted.
+	Kinds kindsFlag
+	// Match and ExcludeMatch select the messages by their text.
+	Match        matcherFlag
+	ExcludeMatch matcherFlag
+
+	// KeepLast and KeepNewer define the retention of the recent messages.
+	KeepLast  int
+	KeepNewer ageFlag
+
+	// Config is the configuration file with the wipe rules.
+	Config string
+	// Daemon requests to run the configuration rules on Schedule.
+	Daemon   bool
+	Schedule string
+
+	// TTL is the time after which the new outgoing messages in the TTLChats
+	// are deleted.
+	TTL      ageFlag
+	TTLChats string
+
+	// AutoDelete is the Telegram auto-delete period to set for the
+	// AutoDeleteChats, "off" or "show".
+	AutoDelete      string
+	AutoDeleteChats string
+
+	// Protect and Unprotect add and remove the chats to the protected list,
+	// and ShowProtected prints it.
+	Protect       chatSelectors
+	Unprotect     chatSelectors
+	ShowProtected bool
 
 	Version bool
 	Verbose bool
 	Trace   string
 
 	cacheDir string
+	config   *waipu.Config
+	schedule waipu.Schedule
+	ttlChats waipu.Selector
+
+	autoDeleteChats  waipu.Selector
+	autoDeletePeriod time.Duration
+
+	// protected are the chats that are never wiped.
+	protected *waipu.Protected
+	// checkpoints record the progress of wiping each chat.
+	checkpoints *waipu.Checkpoints
+	// marks are the high-water marks of the incremental batch wipes.
+	marks *waipu.Marks
+	// limiter handles the Telegram rate limits.
+	limiter *waipu.Limiter
 }
 
 func main() {
@@ -85,29 +176,125 @@ func main() {
 	dlog.SetDebug(p.Verbose)
 
 	if err := run(context.Background(), p); err != nil {
-		dlog.Fatal(err)
+		dlog.Print(err)
+		os.Exit(exitCode(err))
 	}
 }
 
-type chatIDs []int64
+// Exit codes.
+const (
+	exitError       = 1   // general error, or all chats failed
+	exitPartial     = 2   // some chats failed
+	exitNotFound    = 3   // some chats were not found
+	exitAuth        = 4   // authentication error
+	exitLimit       = 5   // the run limit is reached
+	exitInterrupted = 130 // interrupted by the signal
+)
 
-func (c *chatIDs) Set(val string) error {
-	ss := strings.Split(val, ",")
-	ids := make([]int64, 0, len(ss))
+// exitCode returns the exit code for the error.
+func exitCode(err error) int {
+	switch {
+	case errors.Is(err, context.Canceled):
+		return exitInterrupted
+	case waipu.IsAuthError(err):
+		return exitAuth
+	case errors.Is(err, waipu.ErrPartial):
+		return exitPartial
+	case errors.Is(err, waipu.ErrLimitReached):
+		return exitLimit
+	case errors.Is(err, waipu.ErrChatNotFound):
+		return exitNotFound
+	}
+	return exitError
+}
 
-	for _, sID := range ss {
-		id, err := strconv.ParseInt(sID, 10, 64)
-		if err != nil {
-			return err
-		}
-		ids = append(ids, id)
+// chatSelectors is the flag that accepts the comma separated list of chat
+// IDs and selectors, see waipu.Selector.
+type chatSelectors []string
+
+func (c *chatSelectors) Set(val string) error {
+	specs := waipu.SplitSelectors(val)
+	if _, err := waipu.ParseSelector(specs...); err != nil {
+		return err
+	}
+	*c = specs
+	return nil
+}
+
+func (c *chatSelectors) String() string {
+	return strings.Join(*c, ",")
+}
+
+// dateFlag is the flag that accepts the date in one of the formats supported
+// by waipu.ParseDate.
+type dateFlag struct {
+	time.Time
+}
+
+func (d *dateFlag) Set(val string) error {
+	t, err := waipu.ParseDate(val)
+	if err != nil {
+		return err
 	}
-	*c = ids
+	d.Time = t
 	return nil
 }
 
-func (c *chatIDs) String() string {
-	return fmt.Sprint([]int64(*c))
+func (d *dateFlag) String() string {
+	if d.IsZero() {
+		return ""
+	}
+	return d.Format(time.DateTime)
+}
+
+// kindsFlag is the flag that accepts the comma separated list of message
+// types.
+type kindsFlag []waipu.Kind
+
+func (k *kindsFlag) Set(val string) error {
+	kinds, err := waipu.ParseKinds(val)
+	if err != nil {
+		return err
+	}
+	*k = kinds
+	return nil
+}
+
+func (k *kindsFlag) String() string {
+	return fmt.Sprint([]waipu.Kind(*k))
+}
+
+// ageFlag is the flag that accepts the age in days, weeks or as a duration.
+type ageFlag time.Duration
+
+func (a *ageFlag) Set(val string) error {
+	d, err := waipu.ParseAge(val)
+	if err != nil {
+		return err
+	}
+	*a = ageFlag(d)
+	return nil
+}
+
+func (a *ageFlag) String() string {
+	if *a == 0 {
+		return ""
+	}
+	return time.Duration(*a).String()
+}
+
+// matcherFlag is the flag that accepts the message text matcher.
+type matcherFlag struct {
+	*waipu.Matcher
+}
+
+func (m *matcherFlag) Set(val string) error {
+	matcher, err := waipu.ParseMatcher(val)
+	if err != nil {
+		return err
+	}
+	m.Matcher = matcher
+	return nil
 }
 
 func parseCmdLine() (Params, error) {
@@ -124,7 +311,42 @@ func parseCmdLine() (Params, error) {
 
 		// batch mode
 		flag.BoolVar(&p.List, "list", false, "list channels and their IDs")
-		flag.Var(&p.Batch, "wipe", "batch mode, specify comma separated chat IDs on the command line")
+		flag.StringVar(&p.ListFormat, "format", "text", "-list output `format`: text, json, csv or tsv")
+		flag.Var(&p.ListFilter, "list-filter", "-list only the chats selected by the comma separated `selectors`, i.e. type:megagroup,title:/news/i")
+		flag.BoolVar(&p.Count, "count", false, "show the number of your messages in each chat, in -list and in the GUI mode")
+		flag.Var(&p.Batch, "wipe", "batch mode, specify comma separated chat IDs or `selectors` on the command line: @username, title:TEXT, title:/REGEXP/i, type:TYPE, folder:NAME or all")
+		flag.StringVar(&p.WipeFile, "wipe-file", "", "batch mode, read the chat IDs or selectors to wipe from the `file`, one per line, or from stdin if \"-\"")
+		flag.BoolVar(&p.Yes, "yes", false, "batch mode: do not ask to confirm the list of chats to wipe")
+		flag.StringVar(&p.Config, "config", "", "batch mode, run the wipe rules from the YAML configuration `file`")
+		flag.BoolVar(&p.Daemon, "daemon", false, "run the rules from the configuration file (-config) on schedule, until terminated")
+		flag.StringVar(&p.Schedule, "schedule", "@daily", "daemon mode `schedule`: @every AGE, @hourly, @daily, @weekly, @monthly, or the cron expression, i.e. \"30 3 * * *\"")
+		flag.Var(&p.TTL, "ttl", "watch mode: delete my new messages in the -ttl-chats after the `age`, i.e. 1d or 30m")
+		flag.StringVar(&p.TTLChats, "ttl-chats", "", "watch mode: comma separated chat IDs or `selectors` (@username, title:TEXT, title:/REGEXP/i, type:TYPE)")
+		flag.StringVar(&p.AutoDelete, "autodelete", "", "set the Telegram auto-delete `period` for the -autodelete-chats: 1d, 1w, 1m (month), or any age from 1d to 365d, \"off\" to turn it off, or \"show\" to report it")
+		flag.StringVar(&p.AutoDeleteChats, "autodelete-chats", "", "comma separated chat IDs or `selectors` for -autodelete (@username, title:TEXT, title:/REGEXP/i, type:TYPE, folder:NAME)")
+		flag.Var(&p.Protect, "protect", "add the chats selected by the comma separated `selectors` to the protected list, their messages are never deleted")
+		flag.Var(&p.Unprotect, "unprotect", "remove the chats selected by the comma separated `selectors` from the protected list")
+		flag.BoolVar(&p.ShowProtected, "protected", false, "show the protected chats")
+		flag.BoolVar(&p.DryRun, "dry-run", false, "batch mode: scan the chats and report what would be deleted, without deleting anything")
+		flag.StringVar(&p.Plan, "plan", "", "batch mode: scan the chats and save the messages to be deleted to the plan `file`, without deleting anything")
+		flag.BoolVar(&p.Resume, "resume", false, "continue the interrupted wipe from where it stopped, in the batch, daemon and GUI modes")
+		flag.BoolVar(&p.Full, "full", false, "batch mode: scan the complete history of the chats, instead of only the messages newer than the last run")
+		flag.IntVar(&p.MaxMessages, "max-messages", 0, "batch and daemon modes: stop the run after deleting `N` messages, the rest are deleted on the next run")
+		flag.DurationVar(&p.MaxDuration, "max-duration", 0, "batch and daemon modes: stop the run after the `duration`, i.e. 2h or 30m")
+		flag.StringVar(&p.Report, "report", "", "batch mode: save the JSON report with the result of each chat to the `file`")
+		flag.StringVar(&p.Apply, "apply", "", "delete the messages listed in the plan `file`, made with -plan")
+		flag.StringVar(&p.ExportDir, "export", "", "export the messages to JSON files in the `directory` before deleting them")
+		flag.StringVar(&p.ExportFormat, "export-format", "json", "export `format`: json or html")
+		flag.BoolVar(&p.Media, "media", false, "download the media files of the messages to the export directory before deleting them (requires -export)")
+
+		// filters
+		flag.Var(&p.Before, "before", "delete only messages sent before this `date` (YYYY-MM-DD[THH:MM:SS])")
+		flag.Var(&p.After, "after", "delete only messages sent on or after this `date` (YYYY-MM-DD[THH:MM:SS])")
+		flag.Var(&p.Match, "match", "delete only messages with the text that matches the `pattern`: substring, kw:WORD1,WORD2 for any of the keywords (case-insensitive), or re:EXPR for a regular expression")
+		flag.Var(&p.ExcludeMatch, "exclude-match", "do not delete messages with the text that matches the `pattern`, see -match for the syntax")
+		flag.IntVar(&p.KeepLast, "keep-last", 0, "keep the `N` most recent messages in each chat")
+		flag.Var(&p.KeepNewer, "keep-newer", "keep the messages newer than the `age`, i.e. 30d, 2w or 12h")
+		flag.Var(&p.Kinds, "types", "delete only messages of these comma separated `types`: "+waipu.JoinKinds(waipu.FilterKinds))
 
 		// sundry
 		flag.BoolVar(&p.Version, "v", false, "print version and exit")
@@ -133,9 +355,206 @@ func parseCmdLine() (Params, error) {
 
 		flag.Parse()
 	}
+	if err := p.filter().Validate(); err != nil {
+		return p, err
+	}
+	if f, err := waipu.ParseListFormat(p.ListFormat); err != nil {
+		return p, err
+	} else {
+		p.ListFormat = string(f)
+	}
+	if _, err := export.ParseFormat(p.ExportFormat); err != nil {
+		return p, err
+	}
+	if p.WipeFile != "" {
+		specs, err := readWipeFile(p.WipeFile)
+		if err != nil {
+			return p, err
+		}
+		if len(specs) == 0 {
+			return p, fmt.Errorf("%s: no chats to wipe", p.WipeFile)
+		}
+		if p.WipeFile == "-" && !p.Yes && !p.DryRun && p.Plan == "" {
+			return p, errors.New("-wipe-file - reads the standard input, so the wipe can not be confirmed, use -yes")
+		}
+		p.Batch = append(p.Batch, specs...)
+	}
+	for _, f := range []struct {
+		name  string
+		specs chatSelectors
+	}{{"-wipe", p.Batch}, {"-list-filter", p.ListFilter}, {"-protect", p.Protect}, {"-unprotect", p.Unprotect}} {
+		// validated by the flag, except for the -wipe-file selectors.
+		sel, err := waipu.ParseSelector(f.specs...)
+		if err != nil {
+			return p, err
+		}
+		if sel.HasPrivate() {
+			return p, fmt.Errorf("%s does not support private chats (type:private), only -autodelete-chats does", f.name)
+		}
+	}
+	if p.Media && p.ExportDir == "" {
+		return p, errors.New("-media requires the export directory (-export)")
+	}
+	if p.Apply != "" && p.ExportDir != "" {
+		return p, errors.New("-export is not supported with -apply, use it with -plan instead")
+	}
+	if p.Config != "" {
+		if len(p.Batch) > 0 {
+			return p, errors.New("-config and -wipe are mutually exclusive")
+		}
+		cfg, err := waipu.LoadConfig(p.Config)
+		if err != nil {
+			return p, err
+		}
+		p.config = cfg
+	}
+	if p.Daemon {
+		if p.config == nil {
+			return p, errors.New("-daemon requires the configuration file (-config)")
+		}
+		sched, err := waipu.ParseSchedule(p.Schedule)
+		if err != nil {
+			return p, err
+		}
+		p.schedule = sched
+	}
+	if p.TTL > 0 {
+		sel, err := waipu.ParseSelector(waipu.SplitSelectors(p.TTLChats)...)
+		if err != nil {
+			return p, err
+		}
+		if sel.IsEmpty() {
+			return p, errors.New("-ttl requires the list of chats to watch (-ttl-chats)")
+		}
+		if sel.HasPrivate() {
+			return p, errors.New("-ttl does not support private chats (type:private)")
+		}
+		if len(p.Batch) > 0 || p.config != nil || p.Apply != "" {
+			return p, errors.New("-ttl can not be combined with -wipe, -config or -apply")
+		}
+		if p.DryRun || p.Plan != "" || p.ExportDir != "" {
+			return p, errors.New("-dry-run, -plan and -export are not supported with -ttl")
+		}
+		p.ttlChats = sel
+	}
+	if p.AutoDelete != "" {
+		sel, err := waipu.ParseSelector(waipu.SplitSelectors(p.AutoDeleteChats)...)
+		if err != nil {
+			return p, err
+		}
+		if sel.IsEmpty() {
+			return p, errors.New("-autodelete requires the list of chats (-autodelete-chats)")
+		}
+		if p.AutoDelete != "show" {
+			if p.autoDeletePeriod, err = waipu.ParseAutoDelete(p.AutoDelete); err != nil {
+				return p, err
+			}
+		}
+		p.autoDeleteChats = sel
+	}
+	if len(p.Protect) > 0 || len(p.Unprotect) > 0 {
+		if len(p.Protect) > 0 && len(p.Unprotect) > 0 {
+			return p, errors.New("-protect and -unprotect are mutually exclusive")
+		}
+		if len(p.Batch) > 0 || p.config != nil || p.Apply != "" || p.TTL > 0 || p.AutoDelete != "" {
+			return p, errors.New("-protect and -unprotect can not be combined with -wipe, -config, -apply, -ttl or -autodelete")
+		}
+	}
+	if p.Resume {
+		if p.DryRun || p.Plan != "" {
+			return p, errors.New("-resume is not supported with -dry-run and -plan")
+		}
+		if p.ExportDir != "" {
+			return p, errors.New("-resume is not supported with -export, as the messages found before the interruption can not be exported")
+		}
+	}
+	if p.Full && len(p.Batch) == 0 && p.config == nil {
+		return p, errors.New("-full requires the list of chats to wipe (-wipe or -config)")
+	}
+	if p.MaxMessages < 0 || p.MaxDuration < 0 {
+		return p, errors.New("-max-messages and -max-duration must not be negative")
+	}
+	if p.MaxMessages > 0 || p.MaxDuration > 0 {
+		if len(p.Batch) == 0 && p.config == nil {
+			return p, errors.New("-max-messages and -max-duration require the list of chats to wipe (-wipe or -config)")
+		}
+		if p.DryRun || p.Plan != "" {
+			return p, errors.New("-max-messages and -max-duration are not supported with -dry-run and -plan")
+		}
+	}
+	if p.Report != "" {
+		if p.Daemon {
+			return p, errors.New("-report is not supported in the daemon mode")
+		}
+		if len(p.Batch) == 0 && p.config == nil && p.Apply == "" {
+			return p, errors.New("-report requires the list of chats to wipe (-wipe or -config) or the plan (-apply)")
+		}
+	}
+	if p.Plan != "" {
+		if p.Daemon {
+			return p, errors.New("-plan is not supported in the daemon mode")
+		}
+		if len(p.Batch) == 0 && p.config == nil {
+			return p, errors.New("-plan requires the list of chats to scan (-wipe or -config)")
+		}
+		if p.DryRun {
+			return p, errors.New("-plan and -dry-run are mutually exclusive")
+		}
+	}
 	return p, nil
 }
 
+// readWipeFile reads the chat selectors from the file, or from stdin, if the
+// filename is "-".
+func readWipeFile(filename string) ([]string, error) {
+	if filename == "-" {
+		return waipu.ReadSelectors(os.Stdin)
+	}
+	f, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	specs, err := waipu.ReadSelectors(f)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", filename, err)
+	}
+	return specs, nil
+}
+
+// wiperOptions returns the options for the wiper, that are common for the
+// batch mode and the UI.
+func (p *Params) wiperOptions(cl *tgclient.Client) []waipu.Option {
+	opts := []waipu.Option{
+		waipu.WithProtected(p.protected),
+		waipu.WithLimiter(p.limiter),
+		waipu.WithCheckpoints(p.checkpoints, p.Resume),
+		waipu.WithFilter(p.filter()),
+		waipu.WithRetention(waipu.Retention{KeepLast: p.KeepLast, KeepNewer: time.Duration(p.KeepNewer)}),
+	}
+	if p.ExportDir != "" {
+		format, _ := export.ParseFormat(p.ExportFormat) // validated in parseCmdLine
+		exportOpts := []export.Option{export.WithFormat(format)}
+		if p.Media {
+			exportOpts = append(exportOpts, export.WithMedia(cl))
+		}
+		opts = append(opts, waipu.WithExporter(export.New(p.ExportDir, exportOpts...)))
+	}
+	return opts
+}
+
+// filter returns the message filter set by the command line flags.
+func (p *Params) filter() waipu.Filter {
+	return waipu.Filter{
+		After:  p.After.Time,
+		Before: p.Before.Time,
+		Kinds:  []waipu.Kind(p.Kinds),
+
+		Content:        p.Match.Matcher,
+		ExcludeContent: p.ExcludeMatch.Matcher,
+	}
+}
+
 func (p *Params) initCacheDir(appName string) error {
 	cacheDir, err := os.UserCacheDir()
 	if err != nil {
@@ -165,13 +584,18 @@ func run(ctx context.Context, p Params) error {
 		defer tr.End()
 	}
 
-	header(os.Stdout)
+	// keep the machine-readable list output clean.
+	info := io.Writer(os.Stdout)
+	if p.List && p.ListFormat != string(waipu.ListText) {
+		info = os.Stderr
+	}
+	header(info)
 
 	sessfile := filepath.Join(p.cacheDir, "session.dat")
 	if migrated, err := migratev120(sessfile); err != nil {
 		return err
 	} else if migrated {
-		fmt.Fprintln(os.Stdout, "session file was migrated to new format")
+		fmt.Fprintln(info, "session file was migrated to new format")
 	}
 
 	sessStorage := session.FileStorage{Path: filepath.Join(p.cacheDir, "session.dat")}
@@ -197,9 +621,34 @@ func run(ctx context.Context, p Params) error {
 		os.Exit(0)
 	}
 
+	protected, err := waipu.OpenProtected(filepath.Join(p.cacheDir, "protected.json"))
+	if err != nil {
+		return err
+	}
+	p.protected = protected
+	if p.checkpoints, err = waipu.OpenCheckpoints(filepath.Join(p.cacheDir, "checkpoints.json")); err != nil {
+		return err
+	}
+	if p.marks, err = waipu.OpenMarks(filepath.Join(p.cacheDir, "marks.json")); err != nil {
+		return err
+	}
+	if p.limiter, err = waipu.OpenLimiter(filepath.Join(p.cacheDir, "floodwait.json")); err != nil {
+		return err
+	}
+	if p.ShowProtected {
+		return waipu.PrintProtected(os.Stdout, protected)
+	}
+
 	opts := telegram.Options{
 		SessionStorage: &sessStorage,
 	}
+	dispatcher := tg.NewUpdateDispatcher()
+	// the updates manager expands the short updates, and recovers the
+	// updates lost to the gaps and reconnects.
+	gaps := updates.New(updates.Config{Handler: dispatcher})
+	if p.TTL > 0 {
+		opts.UpdateHandler = gaps
+	}
 
 	cl, err := mtp.New(ctx, p.ApiID, p.ApiHash,
 		mtp.WithAuth(authflow.NewTermAuth(p.Phone)),
@@ -210,6 +659,20 @@ func run(ctx context.Context, p Params) error {
 	if err != nil {
 		return err
 	}
+	tc := tgclient.New(cl)
+	// lc makes all requests through the rate limit controller, so that the
+	// flood waits are shared by all modes, and are persisted.
+	lc := p.limiter.Wrap(tc)
+
+	var watcher *waipu.Watcher
+	if p.TTL > 0 {
+		journal, err := waipu.OpenJournal(filepath.Join(p.cacheDir, "ttl_journal.json"))
+		if err != nil {
+			return err
+		}
+		watcher = waipu.NewWatcher(lc, p.ttlChats, time.Duration(p.TTL), journal, waipu.WithProtected(protected), waipu.WithLimiter(p.limiter))
+		watcher.Register(dispatcher)
+	}
 
 	dlog.Println("Connecting to telegram . . .")
 	if err := cl.Start(ctx); err != nil {
@@ -225,13 +688,95 @@ func run(ctx context.Context, p Params) error {
 	defer stop()
 
 	if p.List {
-		return waipu.List(ctx, os.Stdout, cl)
-	} else if len(p.Batch) > 0 {
-		return waipu.Batch(ctx, cl, []int64(p.Batch))
+		format, _ := waipu.ParseListFormat(p.ListFormat) // validated in parseCmdLine
+		sel, _ := waipu.ParseSelector(p.ListFilter...)   // validated by the flag
+		listOpts := []waipu.ListOption{waipu.WithListFormat(format), waipu.WithListFilter(sel)}
+		if p.Count {
+			listOpts = append(listOpts, waipu.WithListCount(waipu.DefCountConcurrency))
+		}
+		return waipu.List(ctx, os.Stdout, lc, listOpts...)
+	} else if p.AutoDelete == "show" {
+		return waipu.ShowAutoDelete(ctx, os.Stdout, p.limiter.WrapAutoDeleter(tc), p.autoDeleteChats)
+	} else if p.AutoDelete != "" {
+		return waipu.SetAutoDelete(ctx, os.Stdout, p.limiter.WrapAutoDeleter(tc), p.autoDeleteChats, p.autoDeletePeriod, protected)
+	} else if len(p.Protect) > 0 {
+		sel, _ := waipu.ParseSelector(p.Protect...) // validated by the flag
+		return waipu.Protect(ctx, os.Stdout, lc, protected, sel)
+	} else if len(p.Unprotect) > 0 {
+		sel, _ := waipu.ParseSelector(p.Unprotect...) // validated by the flag
+		return waipu.Unprotect(ctx, os.Stdout, lc, protected, sel)
+	} else if watcher != nil {
+		self, err := cl.Client().Self(ctx)
+		if err != nil {
+			return fmt.Errorf("failed to get the current user: %w", err)
+		}
+		return runWatcher(ctx, watcher, gaps, tc.API(), self.ID)
+	} else if p.Apply != "" {
+		plan, err := waipu.LoadPlan(p.Apply)
+		if err != nil {
+			return err
+		}
+		id, err := identity(ctx, cl, &sessStorage)
+		if err != nil {
+			return err
+		}
+		opts := []waipu.Option{waipu.WithProtected(protected)}
+		var report *waipu.Report
+		if p.Report != "" {
+			report = new(waipu.Report)
+			opts = append(opts, waipu.WithReport(report))
+		}
+		err = waipu.Apply(ctx, lc, plan, id, opts...)
+		if report != nil {
+			p.saveReport(report, err)
+		}
+		return err
+	} else if len(p.Batch) > 0 || p.config != nil {
+		opts := append(p.wiperOptions(tc),
+			waipu.WithMarks(p.marks, p.Full),
+			waipu.WithLimits(waipu.Limits{MaxMessages: p.MaxMessages, MaxDuration: p.MaxDuration}),
+		)
+		if p.DryRun {
+			opts = append(opts, waipu.WithDryRun(os.Stdout))
+		}
+		var report *waipu.Report
+		if p.Report != "" {
+			report = new(waipu.Report)
+			opts = append(opts, waipu.WithReport(report))
+		}
+		var plan *waipu.Plan
+		if p.Plan != "" {
+			id, err := identity(ctx, cl, &sessStorage)
+			if err != nil {
+				return err
+			}
+			plan = waipu.NewPlan(id)
+			opts = append(opts, waipu.WithPlan(plan))
+		}
+		err := p.runBatch(ctx, lc, opts)
+		if err != nil && p.checkpoints.Len() > 0 && p.Plan == "" && !p.DryRun {
+			if errors.Is(err, waipu.ErrLimitReached) {
+				dlog.Println("some chats were not finished, run the same command again to continue where it stopped")
+			} else {
+				dlog.Println("some chats were not finished, run the same command with -resume to continue")
+			}
+		}
+		if report != nil {
+			p.saveReport(report, err)
+		}
+		// the plan is saved if some of the chats failed, as they are
+		// reported.
+		if plan != nil && (err == nil || errors.Is(err, waipu.ErrPartial) || errors.Is(err, waipu.ErrChatNotFound)) {
+			if err := plan.Save(p.Plan); err != nil {
+				return fmt.Errorf("failed to save the plan: %w", err)
+			}
+			fmt.Fprintf(os.Stdout, "plan for %d messages in %d chats saved to %s\n", plan.Count(), len(plan.Chats), p.Plan)
+		}
+		return err
 	} else {
 		// run UI
 		done, finished := fakeProgress("Getting chats . . .", 0)
-		chats, err := cl.GetChats(ctx)
+		chats, err := lc.GetChats(ctx)
 		close(done)
 		<-finished
 		if err != nil {
@@ -242,7 +787,10 @@ func run(ctx context.Context, p Params) error {
 		})
 		dlog.Printf("got %d chats", len(chats))
 
-		tva := tui.New(ctx, cl)
+		tva := tui.New(ctx, lc, p.wiperOptions(tc)...)
+		if p.Count {
+			tva.CountMessages(waipu.DefCountConcurrency)
+		}
 		if err := tva.Run(ctx, chats); err != nil {
 			return err
 		}
@@ -251,6 +799,90 @@ func run(ctx context.Context, p Params) error {
 	return nil
 }
 
+// runWatcher runs the watcher, while the updates manager gaps receives the
+// updates for the user with selfID.  The watcher stops, if the updates can
+// not be received.
+func runWatcher(ctx context.Context, watcher *waipu.Watcher, gaps *updates.Manager, api updates.API, selfID int64) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	errC := make(chan error, 1)
+	go func() {
+		defer cancel()
+		// updates are only sent to the client that requested the state,
+		// the manager requests it on start.
+		errC <- gaps.Run(ctx, api, selfID, updates.AuthOptions{})
+	}()
+	err := watcher.Run(ctx)
+	cancel()
+	if gerr := <-errC; err == nil && gerr != nil && !errors.Is(gerr, context.Canceled) {
+		err = fmt.Errorf("failed to receive updates: %w", gerr)
+	}
+	return err
+}
+
+// runBatch runs the batch mode: the rules from the configuration file, if it
+// was given, on schedule in the daemon mode, or the list of chats.
+func (p *Params) runBatch(ctx context.Context, cl waipu.Telegramer, opts []waipu.Option) error {
+	if p.Daemon {
+		d := waipu.Daemon{
+			Config:   p.config,
+			Schedule: p.schedule,
+			Output:   os.Stdout,
+		}
+		if !p.DryRun {
+			d.StateFile = filepath.Join(p.cacheDir, "daemon.json")
+		}
+		return d.Run(ctx, cl, opts...)
+	}
+	if p.config != nil {
+		return waipu.RunRules(ctx, os.Stdout, cl, p.config, opts...)
+	}
+	sel, _ := waipu.ParseSelector(p.Batch...) // validated by the flag
+	targets, err := waipu.ResolveTargets(ctx, cl, sel)
+	if err != nil {
+		return err
+	}
+	if len(targets.Chats) == 0 {
+		if len(targets.Missing) > 0 {
+			return fmt.Errorf("no chats selected: %w: %s", waipu.ErrChatNotFound, strings.Join(targets.Missing, ", "))
+		}
+		return errors.New("no chats selected")
+	}
+	if err := waipu.PrintTargets(os.Stdout, targets); err != nil {
+		return err
+	}
+	// nothing is deleted in the dry run and planning modes.
+	if !p.Yes && !p.DryRun && p.Plan == "" {
+		if !confirm(os.Stdin, os.Stdout, fmt.Sprintf("Delete your messages in %d chats?", len(targets.Chats))) {
+			return errors.New("cancelled, use -yes to skip the confirmation")
+		}
+	}
+	return waipu.Batch(ctx, cl, targets, opts...)
+}
+
+// saveReport saves the report of the run, that returned err, to the -report
+// file.
+func (p *Params) saveReport(report *waipu.Report, err error) {
+	if err != nil && report.Error == "" {
+		report.Error = err.Error()
+	}
+	if err := report.Save(p.Report); err != nil {
+		dlog.Printf("failed to save the report: %s", err)
+	}
+}
+
+// confirm asks the user to confirm the action, and returns true if the
+// answer is "y" or "yes".
+func confirm(r io.Reader, w io.Writer, prompt string) bool {
+	fmt.Fprintf(w, "%s [y/N] ", prompt)
+	answer, _ := bufio.NewReader(r).ReadString('\n')
+	switch strings.ToLower(strings.TrimSpace(answer)) {
+	case "y", "yes":
+		return true
+	}
+	return false
+}
+
 // fakeProgress starts a fake spinner and returns a channel that must be closed
 // once the operation completes. interval is interval between iterations. If not
 // set, will default to 50ms.
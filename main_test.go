@@ -0,0 +1,38 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/gotd/td/tgerr"
+	mtp "github.com/rusq/mtpwrap"
+
+	"github.com/rusq/wipemychat/internal/waipu"
+)
+
+func Test_exitCode(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want int
+	}{
+		{"general", errors.New("boom"), exitError},
+		{"failed", fmt.Errorf("%w: 2 chats", waipu.ErrFailed), exitError},
+		{"partial", fmt.Errorf("%w: 1 of 2 chats", waipu.ErrPartial), exitPartial},
+		{"not found", fmt.Errorf("no chats selected: %w", waipu.ErrChatNotFound), exitNotFound},
+		{"limit", fmt.Errorf("%w, 2 chats were not finished", waipu.ErrLimitReached), exitLimit},
+		{"auth", &mtp.ErrAuth{Err: errors.New("PHONE_CODE_INVALID")}, exitAuth},
+		{"no credentials", mtp.ErrNoCredentials, exitAuth},
+		{"unauthorized", fmt.Errorf("two: %w", tgerr.New(401, "AUTH_KEY_UNREGISTERED")), exitAuth},
+		{"interrupted", fmt.Errorf("interrupted: %w", context.Canceled), exitInterrupted},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := exitCode(tt.err); got != tt.want {
+				t.Errorf("exitCode(%v) = %d, want %d", tt.err, got, tt.want)
+			}
+		})
+	}
+}